@@ -1,18 +1,15 @@
 package main
 
-type Action int
+import "hwacha/bagh/engine"
+
+type Action = engine.Action
 
 const (
-	Boost Action = iota
-	Attack
-	Guard
-	Heal
-	Unchosen
+	Boost    = engine.Boost
+	Attack   = engine.Attack
+	Guard    = engine.Guard
+	Heal     = engine.Heal
+	Unchosen = engine.Unchosen
 )
 
-var actionStrings = map[Action]string{
-	Boost:  "⬆️ **BOOST** ⬆️",
-	Attack: "⚔️ **ATTACK** ⚔️",
-	Guard:  "🛡️ **GUARD** 🛡️",
-	Heal:   "✨ **HEAL** ✨",
-}
+var actionStrings = engine.ActionStrings
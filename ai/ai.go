@@ -0,0 +1,56 @@
+// Package ai picks BAGH actions for a computer opponent.
+package ai
+
+import (
+	"math/rand/v2"
+
+	"hwacha/bagh/engine"
+)
+
+// DefaultDepth is how many rounds ahead the AI looks before guessing.
+const DefaultDepth = 6
+
+// Strategy returns the equilibrium mixed strategy for player in state,
+// as the probability of choosing each action, indexed by action.
+func Strategy(state engine.State, player int, depth int) [4]float64 {
+	if player == 1 {
+		state = state.Swapped()
+	}
+
+	strategy, _, _ := SolveMatrixGame(newSearcher().payoffs(state, depth))
+
+	var probabilities [4]float64
+	for i, action := range actions {
+		probabilities[action] = strategy[i]
+	}
+	return probabilities
+}
+
+// Sample draws an action from a mixed strategy.
+func Sample(strategy [4]float64, rng *rand.Rand) engine.Action {
+	total := 0.0
+	for _, probability := range strategy {
+		total += probability
+	}
+
+	roll := rng.Float64() * total
+	for _, action := range actions {
+		roll -= strategy[action]
+		if roll < 0 {
+			return action
+		}
+	}
+	return actions[len(actions)-1]
+}
+
+// Choose picks player's action in state from the equilibrium strategy,
+// looking it up in a solved strategy table if one is loaded for the
+// match's rules and searching for it otherwise.
+func Choose(state engine.State, player int, rng *rand.Rand) engine.Action {
+	if table, found := strategyTables[tableKey(state.Rules)]; found {
+		if strategy, _, found := table.Lookup(state, player); found {
+			return Sample(strategy, rng)
+		}
+	}
+	return Sample(Strategy(state, player, DefaultDepth), rng)
+}
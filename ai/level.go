@@ -0,0 +1,113 @@
+package ai
+
+import (
+	"math/rand/v2"
+
+	"hwacha/bagh/engine"
+)
+
+// Level is how hard the computer opponent plays.
+type Level int
+
+const (
+	Random Level = iota
+	Greedy
+	Lookahead
+	Equilibrium
+)
+
+// Levels lists the difficulty levels from easiest to hardest.
+var Levels = []Level{Random, Greedy, Lookahead, Equilibrium}
+
+var levelStrings = map[Level]string{
+	Random:      "random",
+	Greedy:      "greedy",
+	Lookahead:   "lookahead",
+	Equilibrium: "equilibrium",
+}
+
+var levelTitles = map[Level]string{
+	Random:      "Random",
+	Greedy:      "Greedy",
+	Lookahead:   "Lookahead",
+	Equilibrium: "Equilibrium",
+}
+
+func (l Level) String() string {
+	return levelStrings[l]
+}
+
+// Title is the level's name as shown to players.
+func (l Level) Title() string {
+	return levelTitles[l]
+}
+
+func ParseLevel(name string) (Level, bool) {
+	for level, levelString := range levelStrings {
+		if levelString == name {
+			return level, true
+		}
+	}
+	return Random, false
+}
+
+// ChooseAt picks player's action in state, playing at the given level.
+func ChooseAt(level Level, state engine.State, player int, rng *rand.Rand) engine.Action {
+	switch level {
+	case Greedy:
+		return chooseGreedy(state, player)
+	case Lookahead:
+		return chooseLookahead(state, player, rng)
+	case Equilibrium:
+		return Choose(state, player, rng)
+	default:
+		return actions[rng.IntN(len(actions))]
+	}
+}
+
+// attack when lethal, heal when low, guard when the opponent is boosted,
+// and otherwise build up a boost before attacking
+func chooseGreedy(state engine.State, player int) engine.Action {
+	self := state.Players[player]
+	opponent := state.Players[1-player]
+
+	if 1+self.Boost >= opponent.HP {
+		return engine.Attack
+	}
+	if self.HP <= 1+opponent.Boost {
+		return engine.Heal
+	}
+	if opponent.Boost > 0 && self.ShieldBreakCounter == 0 {
+		return engine.Guard
+	}
+	if self.Boost < 2 {
+		return engine.Boost
+	}
+	return engine.Attack
+}
+
+// the best response to an opponent that picks uniformly at random,
+// looking two rounds ahead
+func chooseLookahead(state engine.State, player int, rng *rand.Rand) engine.Action {
+	if player == 1 {
+		state = state.Swapped()
+	}
+
+	payoffs := newSearcher().payoffs(state, 2)
+
+	best := []engine.Action{}
+	bestValue := 0.0
+	for row, action := range actions {
+		value := 0.0
+		for _, payoff := range payoffs[row] {
+			value += payoff / float64(len(actions))
+		}
+		if len(best) == 0 || value > bestValue+epsilon {
+			best = []engine.Action{action}
+			bestValue = value
+		} else if value > bestValue-epsilon {
+			best = append(best, action)
+		}
+	}
+	return best[rng.IntN(len(best))]
+}
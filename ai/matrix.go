@@ -0,0 +1,111 @@
+package ai
+
+import "math"
+
+const epsilon = 1e-9
+
+// SolveMatrixGame finds optimal mixed strategies for the zero-sum game where
+// the row player picks a row, the column player picks a column, and the row
+// player wins payoffs[row][column] from the column player.
+// It returns both players' strategies and the value of the game to the row player.
+func SolveMatrixGame(payoffs [][]float64) ([]float64, []float64, float64) {
+	m := len(payoffs)
+	n := len(payoffs[0])
+
+	// shift every payoff above 0 so the value of the game is positive,
+	// which turns the column player's problem into
+	//   maximize sum(w) subject to payoffs * w <= 1, w >= 0
+	// where the column strategy is w / sum(w) and the value is 1 / sum(w)
+	lowest := math.Inf(1)
+	for _, row := range payoffs {
+		for _, payoff := range row {
+			lowest = min(lowest, payoff)
+		}
+	}
+	shift := 1 - lowest
+
+	width := n + m + 1
+	rhs := width - 1
+	tableau := make([][]float64, m+1)
+	for i := range tableau {
+		tableau[i] = make([]float64, width)
+	}
+	basis := make([]int, m)
+	for i := 0; i < m; i++ {
+		for j := 0; j < n; j++ {
+			tableau[i][j] = payoffs[i][j] + shift
+		}
+		tableau[i][n+i] = 1
+		tableau[i][rhs] = 1
+		basis[i] = n + i
+	}
+	objective := tableau[m]
+	for j := 0; j < n; j++ {
+		objective[j] = -1
+	}
+
+	for {
+		// Bland's rule: the lowest improving column enters,
+		// which keeps the simplex method from cycling
+		entering := -1
+		for j := 0; j < rhs; j++ {
+			if objective[j] < -epsilon {
+				entering = j
+				break
+			}
+		}
+		if entering == -1 {
+			break
+		}
+
+		leaving := -1
+		bestRatio := math.Inf(1)
+		for i := 0; i < m; i++ {
+			if tableau[i][entering] <= epsilon {
+				continue
+			}
+			ratio := tableau[i][rhs] / tableau[i][entering]
+			if ratio < bestRatio-epsilon || (ratio < bestRatio+epsilon && leaving != -1 && basis[i] < basis[leaving]) {
+				bestRatio = ratio
+				leaving = i
+			}
+		}
+		if leaving == -1 {
+			// unbounded, which can't happen when every payoff is positive
+			break
+		}
+
+		pivot := tableau[leaving][entering]
+		for j := range tableau[leaving] {
+			tableau[leaving][j] /= pivot
+		}
+		for i := range tableau {
+			if i == leaving || tableau[i][entering] == 0 {
+				continue
+			}
+			factor := tableau[i][entering]
+			for j := range tableau[i] {
+				tableau[i][j] -= factor * tableau[leaving][j]
+			}
+		}
+		basis[leaving] = entering
+	}
+
+	shiftedValue := 1 / objective[rhs]
+
+	columnStrategy := make([]float64, n)
+	for i, variable := range basis {
+		if variable < n {
+			columnStrategy[variable] = tableau[i][rhs] * shiftedValue
+		}
+	}
+
+	// the row player's strategy is the dual solution,
+	// read off the objective row under the slack columns
+	rowStrategy := make([]float64, m)
+	for i := 0; i < m; i++ {
+		rowStrategy[i] = max(0, objective[n+i]) * shiftedValue
+	}
+
+	return rowStrategy, columnStrategy, shiftedValue - shift
+}
@@ -0,0 +1,82 @@
+package ai
+
+import (
+	"math"
+
+	"hwacha/bagh/engine"
+)
+
+var actions = [4]engine.Action{engine.Boost, engine.Attack, engine.Guard, engine.Heal}
+
+type searchKey struct {
+	state engine.State
+	depth int
+}
+
+// searcher values states for player 0 with a depth-limited lookahead,
+// treating every round as a simultaneous-move matrix game and every
+// shield mending roll as a chance node. Values range from -1 (player 0
+// has lost the game) to 1 (player 0 has won it).
+type searcher struct {
+	values map[searchKey]float64
+}
+
+func newSearcher() *searcher {
+	return &searcher{values: make(map[searchKey]float64)}
+}
+
+func (s *searcher) value(state engine.State, depth int) float64 {
+	if depth == 0 {
+		return evaluate(state)
+	}
+
+	key := searchKey{state: state, depth: depth}
+	if value, found := s.values[key]; found {
+		return value
+	}
+
+	_, _, value := SolveMatrixGame(s.payoffs(state, depth))
+	s.values[key] = value
+	return value
+}
+
+// payoffs is the expected value to player 0 of every pair of actions,
+// with player 0's actions as rows and player 1's as columns
+func (s *searcher) payoffs(state engine.State, depth int) [][]float64 {
+	outcomes := engine.MendOutcomes(state)
+
+	payoffs := make([][]float64, len(actions))
+	for row, rowAction := range actions {
+		payoffs[row] = make([]float64, len(actions))
+		for column, columnAction := range actions {
+			expected := 0.0
+			for _, outcome := range outcomes {
+				next, events := engine.ResolveRolled(state, [2]engine.Action{rowAction, columnAction}, outcome.Mended)
+				expected += outcome.Probability * s.childValue(next, events, depth-1)
+			}
+			payoffs[row][column] = expected
+		}
+	}
+	return payoffs
+}
+
+func (s *searcher) childValue(next engine.State, events []engine.Event, depth int) float64 {
+	if over, winner := gameResult(events); over {
+		return terminalValue(winner)
+	}
+	return s.value(next, depth)
+}
+
+// evaluate guesses how a game will go from state without looking ahead,
+// keeping clear of the values of games that are actually over.
+func evaluate(state engine.State) float64 {
+	p0, p1 := state.Players[0], state.Players[1]
+	rules := state.Rules
+
+	score := float64(p0.HP-p1.HP)/float64(rules.StartingHP) +
+		0.15*float64(p0.Boost-p1.Boost) +
+		0.1*float64(p0.Priority-p1.Priority) -
+		0.1*float64(p0.ShieldBreakCounter-p1.ShieldBreakCounter)
+
+	return 0.9 * math.Tanh(score)
+}
@@ -0,0 +1,184 @@
+package ai
+
+import (
+	"math"
+
+	"hwacha/bagh/engine"
+)
+
+// StateKey identifies a position within a game. The score and round
+// are left out because they don't change how a game is played.
+type StateKey uint64
+
+func KeyOf(state engine.State) StateKey {
+	p0, p1 := state.Players[0], state.Players[1]
+	fields := [8]int{
+		p0.HP, p1.HP,
+		p0.Boost, p1.Boost,
+		p0.Priority, p1.Priority,
+		p0.ShieldBreakCounter, p1.ShieldBreakCounter,
+	}
+
+	var key StateKey
+	for _, field := range fields {
+		key = key<<8 | StateKey(min(field, math.MaxUint8))
+	}
+	return key
+}
+
+// State rebuilds the position a key was made from, at the start of a match played under rules.
+func (key StateKey) State(rules engine.Ruleset) engine.State {
+	var fields [8]int
+	for i := len(fields) - 1; i >= 0; i-- {
+		fields[i] = int(key & math.MaxUint8)
+		key >>= 8
+	}
+
+	state := engine.NewState(rules)
+	for i := range state.Players {
+		state.Players[i].HP = fields[i]
+		state.Players[i].Boost = fields[2+i]
+		state.Players[i].Priority = fields[4+i]
+		state.Players[i].ShieldBreakCounter = fields[6+i]
+	}
+	return state
+}
+
+type transition struct {
+	probability float64
+	// index of the next position, or -1 if the game ended
+	next     int
+	terminal float64
+}
+
+type position struct {
+	state engine.State
+	// indexed by row*len(actions) + column
+	transitions [len(actions) * len(actions)][]transition
+}
+
+// SolveProgress is called after every sweep of value iteration with the
+// largest change to any position's value during that sweep.
+type SolveProgress func(positions int, sweep int, delta float64)
+
+// Solve enumerates every position reachable in a game played under rules
+// and computes its value and equilibrium strategy with Shapley's value
+// iteration, treating shield mending rolls as chance nodes. It sweeps until
+// no value changes by more than tolerance, or maxSweeps is reached.
+func Solve(rules engine.Ruleset, tolerance float64, maxSweeps int, progress SolveProgress) *StrategyTable {
+	positions, indices := enumeratePositions(rules)
+
+	values := make([]float64, len(positions))
+	payoffs := make([][]float64, len(actions))
+	for row := range payoffs {
+		payoffs[row] = make([]float64, len(actions))
+	}
+
+	fillPayoffs := func(p *position) {
+		for row := range actions {
+			for column := range actions {
+				expected := 0.0
+				for _, t := range p.transitions[row*len(actions)+column] {
+					if t.next == -1 {
+						expected += t.probability * t.terminal
+					} else {
+						expected += t.probability * values[t.next]
+					}
+				}
+				payoffs[row][column] = expected
+			}
+		}
+	}
+
+	for sweep := 1; sweep <= maxSweeps; sweep++ {
+		delta := 0.0
+		// updating in place lets later positions in the sweep
+		// see the new values, which speeds up convergence
+		for i := range positions {
+			fillPayoffs(&positions[i])
+			_, _, value := SolveMatrixGame(payoffs)
+			delta = max(delta, math.Abs(value-values[i]))
+			values[i] = value
+		}
+		if progress != nil {
+			progress(len(positions), sweep, delta)
+		}
+		if delta <= tolerance {
+			break
+		}
+	}
+
+	table := newStrategyTable(rules)
+	for key, i := range indices {
+		fillPayoffs(&positions[i])
+		strategy, _, _ := SolveMatrixGame(payoffs)
+		var probabilities [4]float64
+		for row, action := range actions {
+			probabilities[action] = strategy[row]
+		}
+		table.set(key, probabilities, values[i])
+	}
+	return table
+}
+
+func enumeratePositions(rules engine.Ruleset) ([]position, map[StateKey]int) {
+	positions := []position{}
+	indices := make(map[StateKey]int)
+
+	indexOf := func(state engine.State) int {
+		key := KeyOf(state)
+		if i, found := indices[key]; found {
+			return i
+		}
+		state.Round = 1
+		indices[key] = len(positions)
+		positions = append(positions, position{state: state})
+		return len(positions) - 1
+	}
+
+	indexOf(engine.NewState(rules))
+
+	// positions grows as new ones are found, so this visits all of them
+	for i := 0; i < len(positions); i++ {
+		state := positions[i].state
+		outcomes := engine.MendOutcomes(state)
+		for row, rowAction := range actions {
+			for column, columnAction := range actions {
+				transitions := make([]transition, 0, len(outcomes))
+				for _, outcome := range outcomes {
+					next, events := engine.ResolveRolled(state, [2]engine.Action{rowAction, columnAction}, outcome.Mended)
+					t := transition{probability: outcome.Probability, next: -1}
+					if over, winner := gameResult(events); over {
+						t.terminal = terminalValue(winner)
+					} else {
+						t.next = indexOf(next)
+					}
+					transitions = append(transitions, t)
+				}
+				positions[i].transitions[row*len(actions)+column] = transitions
+			}
+		}
+	}
+
+	return positions, indices
+}
+
+func gameResult(events []engine.Event) (bool, int) {
+	for _, event := range events {
+		if gameWon, isGameWon := event.(engine.GameWon); isGameWon {
+			return true, gameWon.Winner
+		}
+	}
+	return false, engine.NoWinner
+}
+
+func terminalValue(winner int) float64 {
+	switch winner {
+	case 0:
+		return 1
+	case 1:
+		return -1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,222 @@
+package ai
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"hwacha/bagh/engine"
+)
+
+const (
+	tableMagic   = "BAGHSTRT"
+	tableVersion = 1
+)
+
+type tableEntry struct {
+	// probabilities out of math.MaxUint8, indexed by action
+	strategy [4]uint8
+	value    float32
+}
+
+// StrategyTable holds a solved equilibrium strategy for every position
+// of a game, from player 0's side of the table.
+type StrategyTable struct {
+	Rules   engine.Ruleset
+	entries map[StateKey]tableEntry
+}
+
+func newStrategyTable(rules engine.Ruleset) *StrategyTable {
+	return &StrategyTable{Rules: rules, entries: make(map[StateKey]tableEntry)}
+}
+
+func (t *StrategyTable) set(key StateKey, strategy [4]float64, value float64) {
+	var entry tableEntry
+	for action, probability := range strategy {
+		entry.strategy[action] = uint8(math.Round(probability * math.MaxUint8))
+	}
+	entry.value = float32(value)
+	t.entries[key] = entry
+}
+
+func (t *StrategyTable) Len() int {
+	return len(t.entries)
+}
+
+// Lookup returns player's strategy in state and the value of the position
+// to them, if the table has it.
+func (t *StrategyTable) Lookup(state engine.State, player int) ([4]float64, float64, bool) {
+	if player == 1 {
+		state = state.Swapped()
+	}
+	entry, found := t.entries[KeyOf(state)]
+	if !found {
+		return [4]float64{}, 0, false
+	}
+
+	var strategy [4]float64
+	total := 0.0
+	for action, weight := range entry.strategy {
+		strategy[action] = float64(weight)
+		total += float64(weight)
+	}
+	if total == 0 {
+		return [4]float64{}, 0, false
+	}
+	for action := range strategy {
+		strategy[action] /= total
+	}
+	return strategy, float64(entry.value), true
+}
+
+// Keys lists every position in the table in a stable order.
+func (t *StrategyTable) Keys() []StateKey {
+	keys := make([]StateKey, 0, len(t.entries))
+	for key := range t.entries {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func WriteStrategyTable(w io.Writer, t *StrategyTable) error {
+	zw := gzip.NewWriter(w)
+
+	rules := t.Rules
+	header := []any{
+		[]byte(tableMagic),
+		uint32(tableVersion),
+		uint32(len(rules.Name)),
+		[]byte(rules.Name),
+		int32(rules.StartingHP),
+		int32(rules.MaxBoost),
+		int32(rules.MaxHP),
+		int32(rules.GamesToWin),
+		int32(rules.MendBase),
+		uint32(len(t.entries)),
+	}
+	for _, field := range header {
+		if err := binary.Write(zw, binary.LittleEndian, field); err != nil {
+			return err
+		}
+	}
+
+	for _, key := range t.Keys() {
+		entry := t.entries[key]
+		for _, field := range []any{uint64(key), entry.strategy, entry.value} {
+			if err := binary.Write(zw, binary.LittleEndian, field); err != nil {
+				return err
+			}
+		}
+	}
+
+	return zw.Close()
+}
+
+func ReadStrategyTable(r io.Reader) (*StrategyTable, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	read := func(data any) {
+		if err == nil {
+			err = binary.Read(zr, binary.LittleEndian, data)
+		}
+	}
+
+	magic := make([]byte, len(tableMagic))
+	var version, nameLength uint32
+	read(magic)
+	read(&version)
+	if err == nil && (string(magic) != tableMagic || version != tableVersion) {
+		return nil, errors.New("not a version 1 BAGH strategy table")
+	}
+	read(&nameLength)
+	if err != nil {
+		return nil, err
+	}
+
+	name := make([]byte, nameLength)
+	var startingHP, maxBoost, maxHP, gamesToWin, mendBase int32
+	var count uint32
+	read(name)
+	read(&startingHP)
+	read(&maxBoost)
+	read(&maxHP)
+	read(&gamesToWin)
+	read(&mendBase)
+	read(&count)
+	if err != nil {
+		return nil, err
+	}
+
+	table := newStrategyTable(engine.Ruleset{
+		Name:       string(name),
+		StartingHP: int(startingHP),
+		MaxBoost:   int(maxBoost),
+		MaxHP:      int(maxHP),
+		GamesToWin: int(gamesToWin),
+		MendBase:   int(mendBase),
+	})
+	for range count {
+		var key uint64
+		var entry tableEntry
+		read(&key)
+		read(&entry.strategy)
+		read(&entry.value)
+		if err != nil {
+			return nil, err
+		}
+		table.entries[StateKey(key)] = entry
+	}
+	return table, nil
+}
+
+// tables are shared by every ruleset that plays games the same way,
+// so the name, the number of games to win and the clock are left out of the key
+var strategyTables = make(map[engine.Ruleset]*StrategyTable)
+
+func tableKey(rules engine.Ruleset) engine.Ruleset {
+	rules.Name = ""
+	rules.GamesToWin = 0
+	rules.Clock = engine.RoundClock{}
+	return rules
+}
+
+// UseStrategyTable makes the equilibrium AI play from table whenever
+// a match's ruleset plays games the same way as the table's.
+func UseStrategyTable(table *StrategyTable) {
+	strategyTables[tableKey(table.Rules)] = table
+}
+
+// LoadStrategyTables reads every .table file in dir and uses it.
+// It's meant to be called once at startup.
+func LoadStrategyTables(dir string) ([]*StrategyTable, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.table"))
+	if err != nil {
+		return nil, err
+	}
+
+	tables := []*StrategyTable{}
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return tables, err
+		}
+		table, err := ReadStrategyTable(file)
+		file.Close()
+		if err != nil {
+			return tables, errors.New(path + ": " + err.Error())
+		}
+		UseStrategyTable(table)
+		tables = append(tables, table)
+	}
+	return tables, nil
+}
@@ -0,0 +1,181 @@
+// Package board draws pictures of BAGH states, for clients that show emoji inconsistently.
+package board
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strconv"
+	"unicode/utf8"
+
+	"hwacha/bagh/engine"
+)
+
+// the colours a board is drawn with, indexed by the constants below
+var Palette = color.Palette{
+	color.RGBA{0x2b, 0x2d, 0x31, 0xff},
+	color.RGBA{0x38, 0x3a, 0x40, 0xff},
+	color.RGBA{0xf2, 0xf3, 0xf5, 0xff},
+	color.RGBA{0x5c, 0x5f, 0x66, 0xff},
+	color.RGBA{0xed, 0x42, 0x45, 0xff},
+	color.RGBA{0xfe, 0xe7, 0x5c, 0xff},
+	color.RGBA{0xf0, 0xb2, 0x32, 0xff},
+	color.RGBA{0x57, 0xf2, 0x87, 0xff},
+	color.RGBA{0x58, 0x65, 0xf2, 0xff},
+	color.RGBA{0x11, 0x12, 0x14, 0xff},
+	color.RGBA{0x3b, 0x82, 0xf6, 0xff},
+	color.RGBA{0xef, 0x44, 0x44, 0xff},
+}
+
+const (
+	background uint8 = iota
+	panel
+	text
+	empty
+	heart
+	overheal
+	boost
+	priority
+	shield
+	crack
+	challengerAccent
+	challengeeAccent
+)
+
+// players are told apart by the same accents as the round embeds
+var accents = [2]uint8{challengerAccent, challengeeAccent}
+
+const (
+	Width  = 480
+	Height = 216
+
+	columnWidth = Width / 2
+	margin      = 12
+	scale       = 2
+
+	// past this many, priority is drawn as one badge and a count, so it stays in the panel
+	maxPriorityBadges = 8
+)
+
+// Draw pictures the state, with the challenger on the left and the challengee on the right.
+func Draw(state engine.State) *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, Width, Height), Palette)
+	fill(img, img.Rect, background)
+
+	writeText(img, margin, margin, 3, text, "G"+strconv.Itoa(state.Game)+" R"+strconv.Itoa(state.Round))
+	score := strconv.Itoa(state.Players[0].Wins) + "-" + strconv.Itoa(state.Players[1].Wins)
+	writeText(img, Width-margin-textWidth(score, 3), margin, 3, text, score)
+
+	for i, player := range state.Players {
+		drawPlayer(img, i*columnWidth, state.Rules, player, accents[i])
+	}
+	return img
+}
+
+// EncodePNG writes a picture of the state as a PNG.
+func EncodePNG(w io.Writer, state engine.State) error {
+	return png.Encode(w, Draw(state))
+}
+
+func drawPlayer(img *image.Paletted, left int, rules engine.Ruleset, player engine.Player, accent uint8) {
+	fill(img, image.Rect(left+margin/2, 36, left+columnWidth-margin/2, Height-margin/2), panel)
+	x := left + margin
+
+	drawFighter(img, x+16, 44, accent)
+
+	// the shield, cracked with the odds of mending if it's broken
+	shieldX, shieldY := left+columnWidth-margin-9*3, 48
+	if player.ShieldBreakCounter == 0 {
+		drawGlyph(img, shieldX, shieldY, 3, shield, shieldGlyph)
+	} else {
+		drawGlyph(img, shieldX, shieldY, 3, empty, shieldGlyph)
+		drawGlyph(img, shieldX, shieldY, 3, crack, crackGlyph)
+		odds := "1/" + strconv.Itoa(rules.MendOdds(player.ShieldBreakCounter))
+		writeText(img, shieldX+(9*3-textWidth(odds, 2))/2, shieldY+10*3+6, 2, text, odds)
+	}
+
+	// hearts, with any over the starting HP in gold, wrapping onto a second row
+	y := 122
+	perRow := (columnWidth - 2*margin) / ((len(heartGlyph[0]) + 1) * scale)
+	for n := range rules.MaxHP {
+		colour := empty
+		if n < player.HP {
+			colour = heart
+			if n >= rules.StartingHP {
+				colour = overheal
+			}
+		}
+		hx := x + (n%perRow)*(len(heartGlyph[0])+1)*scale
+		hy := y + (n/perRow)*(len(heartGlyph)+2)*scale
+		drawGlyph(img, hx, hy, scale, colour, heartGlyph)
+	}
+	rows := (rules.MaxHP + perRow - 1) / perRow
+	y += rows * (len(heartGlyph) + 2) * scale
+
+	// the boost meter, a segment per point of boost
+	y += 4
+	meterWidth := columnWidth - 2*margin
+	for n := range rules.MaxBoost {
+		colour := empty
+		if n < player.Boost {
+			colour = boost
+		}
+		segmentLeft := x + n*meterWidth/rules.MaxBoost
+		segmentRight := x + (n+1)*meterWidth/rules.MaxBoost - 2
+		fill(img, image.Rect(segmentLeft, y, segmentRight, y+10), colour)
+	}
+	y += 18
+
+	// a badge per level of priority
+	if player.Priority > maxPriorityBadges {
+		drawGlyph(img, x, y, scale, priority, priorityGlyph)
+		writeText(img, x+(len(priorityGlyph[0])+2)*scale, y, scale, text, "×"+strconv.Itoa(player.Priority))
+		return
+	}
+	for n := range player.Priority {
+		drawGlyph(img, x+n*(len(priorityGlyph[0])+2)*scale, y, scale, priority, priorityGlyph)
+	}
+}
+
+// a stick figure with its feet at the bottom of a 64 pixel tall box
+func drawFighter(img *image.Paletted, x int, y int, colour uint8) {
+	fill(img, image.Rect(x+8, y, x+24, y+16), colour)     // head
+	fill(img, image.Rect(x+14, y+16, x+18, y+44), colour) // body
+	fill(img, image.Rect(x, y+22, x+32, y+26), colour)    // arms
+	fill(img, image.Rect(x+6, y+44, x+10, y+64), colour)  // legs
+	fill(img, image.Rect(x+22, y+44, x+26, y+64), colour)
+	fill(img, image.Rect(x+10, y+44, x+22, y+48), colour)
+}
+
+func fill(img *image.Paletted, r image.Rectangle, colour uint8) {
+	r = r.Intersect(img.Rect)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			img.SetColorIndex(x, y, colour)
+		}
+	}
+}
+
+func drawGlyph(img *image.Paletted, x int, y int, scale int, colour uint8, glyph []string) {
+	for row, line := range glyph {
+		for column, pixel := range line {
+			if pixel == '#' {
+				fill(img, image.Rect(x+column*scale, y+row*scale, x+(column+1)*scale, y+(row+1)*scale), colour)
+			}
+		}
+	}
+}
+
+func textWidth(s string, scale int) int {
+	return utf8.RuneCountInString(s)*4*scale - scale
+}
+
+// writes s in the board's font. Characters it doesn't have are left blank.
+func writeText(img *image.Paletted, x int, y int, scale int, colour uint8, s string) {
+	for n, r := range []rune(s) {
+		if glyph, found := font[r]; found {
+			drawGlyph(img, x+n*4*scale, y, scale, colour, glyph)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package board
+
+// glyphs are drawn a pixel per character, filling each '#'
+
+var heartGlyph = []string{
+	".##.##.",
+	"#######",
+	"#######",
+	".#####.",
+	"..###..",
+	"...#...",
+}
+
+var shieldGlyph = []string{
+	"#########",
+	"#########",
+	"#########",
+	"#########",
+	"#########",
+	".#######.",
+	".#######.",
+	"..#####..",
+	"...###...",
+	"....#....",
+}
+
+// a crack down the middle of a shield, drawn over shieldGlyph
+var crackGlyph = []string{
+	"....#....",
+	"...#.....",
+	"...##....",
+	".....#...",
+	"....#....",
+	"...#.....",
+	"....##...",
+	"......#..",
+	".....#...",
+	".........",
+}
+
+var priorityGlyph = []string{
+	"#..#..",
+	".#..#.",
+	"..#..#",
+	".#..#.",
+	"#..#..",
+}
+
+// the few characters the board needs to write, three pixels wide and five tall
+var font = map[rune][]string{
+	'0': {"###", "#.#", "#.#", "#.#", "###"},
+	'1': {".#.", "##.", ".#.", ".#.", "###"},
+	'2': {"###", "..#", "###", "#..", "###"},
+	'3': {"###", "..#", "###", "..#", "###"},
+	'4': {"#.#", "#.#", "###", "..#", "..#"},
+	'5': {"###", "#..", "###", "..#", "###"},
+	'6': {"###", "#..", "###", "#.#", "###"},
+	'7': {"###", "..#", ".#.", ".#.", ".#."},
+	'8': {"###", "#.#", "###", "#.#", "###"},
+	'9': {"###", "#.#", "###", "..#", "###"},
+	'/': {"..#", "..#", ".#.", "#..", "#.."},
+	'-': {"...", "...", "###", "...", "..."},
+	'+': {"...", ".#.", "###", ".#.", "..."},
+	'×': {"...", "#.#", ".#.", "#.#", "..."},
+	'A': {".#.", "#.#", "###", "#.#", "#.#"},
+	'B': {"##.", "#.#", "##.", "#.#", "##."},
+	'C': {"###", "#..", "#..", "#..", "###"},
+	'D': {"##.", "#.#", "#.#", "#.#", "##."},
+	'E': {"###", "#..", "##.", "#..", "###"},
+	'F': {"###", "#..", "##.", "#..", "#.."},
+	'G': {"###", "#..", "#.#", "#.#", "###"},
+	'H': {"#.#", "#.#", "###", "#.#", "#.#"},
+	'I': {"###", ".#.", ".#.", ".#.", "###"},
+	'K': {"#.#", "#.#", "##.", "#.#", "#.#"},
+	'L': {"#..", "#..", "#..", "#..", "###"},
+	'N': {"##.", "#.#", "#.#", "#.#", "#.#"},
+	'O': {"###", "#.#", "#.#", "#.#", "###"},
+	'R': {"##.", "#.#", "##.", "#.#", "#.#"},
+	'S': {"###", "#..", "###", "..#", "###"},
+	'T': {"###", ".#.", ".#.", ".#.", ".#."},
+	'U': {"#.#", "#.#", "#.#", "#.#", "###"},
+	'W': {"#.#", "#.#", "#.#", "###", "#.#"},
+	' ': {"...", "...", "...", "...", "..."},
+}
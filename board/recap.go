@@ -0,0 +1,89 @@
+package board
+
+import (
+	"image"
+	"image/gif"
+	"io"
+	"strconv"
+
+	"hwacha/bagh/engine"
+)
+
+// how long each frame of a recap is shown, in hundredths of a second
+const (
+	frameDelay     = 150
+	lastFrameDelay = 500
+)
+
+var actionLabels = map[engine.Action]string{
+	engine.Boost:  "BOOST",
+	engine.Attack: "ATTACK",
+	engine.Guard:  "GUARD",
+	engine.Heal:   "HEAL",
+	// the player forfeited the round
+	engine.Unchosen: "NONE",
+}
+
+// Recap animates a match played under rules, starting from its first round,
+// then showing what both players did each round and where it left them.
+func Recap(rules engine.Ruleset, rounds []engine.RoundRecord) (*gif.GIF, error) {
+	recap := &gif.GIF{
+		Image: []*image.Paletted{Draw(engine.NewState(rules))},
+		Delay: []int{frameDelay},
+	}
+
+	err := engine.Replay(rules, rounds, func(before engine.State, round engine.RoundRecord, events []engine.Event) {
+		// a round that ends a game is shown before the next game is set up
+		after := round.State
+		gameOver, winner := false, engine.NoWinner
+		for _, event := range events {
+			if won, isGameWon := event.(engine.GameWon); isGameWon {
+				after = before
+				after.Players = won.Final
+				gameOver, winner = true, won.Winner
+			}
+		}
+
+		frame := Draw(after)
+		for i := range after.Players {
+			left := i*columnWidth + margin + 60
+			label := actionLabels[round.Actions[i]]
+			writeText(frame, left, 56, 2, text, label)
+
+			if change := after.Players[i].HP - before.Players[i].HP; change != 0 {
+				colour := heart
+				sign := ""
+				if change > 0 {
+					colour = priority
+					sign = "+"
+				}
+				writeText(frame, left, 74, 2, colour, sign+strconv.Itoa(change))
+			}
+
+			if gameOver && winner == i {
+				writeText(frame, left, 92, 2, overheal, "WINS")
+			}
+		}
+		if gameOver && winner == engine.NoWinner {
+			writeText(frame, (Width-textWidth("DRAW", 3))/2, margin, 3, overheal, "DRAW")
+		}
+
+		recap.Image = append(recap.Image, frame)
+		recap.Delay = append(recap.Delay, frameDelay)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	recap.Delay[len(recap.Delay)-1] = lastFrameDelay
+	return recap, nil
+}
+
+// EncodeRecap writes the recap of a match as a GIF.
+func EncodeRecap(w io.Writer, rules engine.Ruleset, rounds []engine.RoundRecord) error {
+	recap, err := Recap(rules, rounds)
+	if err != nil {
+		return err
+	}
+	return gif.EncodeAll(w, recap)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"time"
+
+	"hwacha/bagh/engine"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// how long before the round clock runs out players who haven't chosen are warned,
+// for each of these that's shorter than the clock
+var roundClockWarnings = []time.Duration{time.Minute, 30 * time.Second, 10 * time.Second}
+
+// starts the clock on the match's current round, if its rules have one.
+// The caller must hold the match's lock.
+func startRoundClock(s *discordgo.Session, guildID string, game *MatchOngoing) {
+	stopRoundClock(game)
+
+	clock := game.State.Rules.Clock
+	if !clock.IsSet() {
+		return
+	}
+
+	round := game.clockRound
+	for _, remaining := range roundClockWarnings {
+		if remaining >= clock.Limit {
+			continue
+		}
+		game.clockTimers = append(game.clockTimers, time.AfterFunc(clock.Limit-remaining, func() {
+			warnOfRoundClock(s, guildID, game, round, remaining)
+		}))
+	}
+	game.clockTimers = append(game.clockTimers, time.AfterFunc(clock.Limit, func() {
+		handleRoundTimeout(s, guildID, game, round)
+	}))
+}
+
+// stops the clock on the match's current round, so that any of its timers
+// that are already going off do nothing. The caller must hold the match's lock.
+func stopRoundClock(game *MatchOngoing) {
+	for _, timer := range game.clockTimers {
+		timer.Stop()
+	}
+	game.clockTimers = nil
+	game.clockRound++
+}
+
+// locks the match if the clock that went off is still running on it.
+// The caller must unlock the match.
+func lockClockedMatch(guildID string, game *MatchOngoing, round int) bool {
+	game.Lock()
+	if game.clockRound != round || !Games.Holds(guildID, game) {
+		game.Unlock()
+		return false
+	}
+	return true
+}
+
+// the players who haven't chosen an action this round
+func playersStillChoosing(game *MatchOngoing) [2]bool {
+	choosing := [2]bool{}
+	for i, player := range game.GetPlayers() {
+		choosing[i] = player.GetAction() == Unchosen
+	}
+	return choosing
+}
+
+func warnOfRoundClock(s *discordgo.Session, guildID string, game *MatchOngoing, round int, remaining time.Duration) {
+	if !lockClockedMatch(guildID, game, round) {
+		return
+	}
+	defer game.Unlock()
+
+	users := []*discordgo.User{}
+	for i, choosing := range playersStillChoosing(game) {
+		if choosing {
+			users = append(users, game.GetPlayers()[i].User)
+		}
+	}
+	if len(users) > 0 {
+		s.ChannelMessageSend(game.Thread.ID, roundClockWarning(users, remaining))
+	}
+}
+
+// applies the rules' timeout policy to whoever hasn't chosen an action in time
+func handleRoundTimeout(s *discordgo.Session, guildID string, game *MatchOngoing, round int) {
+	if !lockClockedMatch(guildID, game, round) {
+		return
+	}
+	defer game.Unlock()
+	defer Games.Save(guildID, game)
+
+	clock := game.State.Rules.Clock
+	players := game.GetPlayers()
+	timedOut := playersStillChoosing(game)
+	users := []*discordgo.User{}
+	outOfTimeouts := [2]bool{}
+	for i, player := range players {
+		if timedOut[i] {
+			users = append(users, player.User)
+			game.Timeouts[i]++
+			outOfTimeouts[i] = clock.MaxTimeouts > 0 && game.Timeouts[i] >= clock.MaxTimeouts
+		}
+	}
+	if len(users) == 0 {
+		return
+	}
+
+	switch {
+	case outOfTimeouts[0] && outOfTimeouts[1]:
+		stopRoundClock(game)
+		cleanupButtons(s, game)
+		var archived *ArchivedMatch
+		if Games.Remove(guildID, game, players[0].User.ID, players[1].User.ID) {
+			archived = archiveMatch(guildID, game, OutcomeForfeit, engine.NoWinner)
+			finishScoreboard(s, game, OutcomeForfeit, engine.NoWinner)
+		}
+		s.ChannelMessageSend(game.Thread.ID, bothPlayersOutOfTimeoutsNotification)
+		postRecap(s, game, archived)
+		return
+	case outOfTimeouts[0] || outOfTimeouts[1]:
+		forfeiter := players[0]
+		if outOfTimeouts[1] {
+			forfeiter = players[1]
+		}
+		s.ChannelMessageSend(game.Thread.ID, outOfTimeoutsNotification(forfeiter.User))
+		forfeitMatch(s, guildID, game, forfeiter.User.ID)
+		return
+	}
+
+	s.ChannelMessageSend(game.Thread.ID, roundClockRanOutNotification(users, clock.OnTimeout))
+
+	switch clock.OnTimeout {
+	case engine.TimeoutGuard:
+		for i, player := range players {
+			if timedOut[i] {
+				player.SetAction(Guard)
+			}
+		}
+		lockActionsForRound(s, game)
+		actionLog, isMatchOver, winner := game.NextStateFromActions()
+		finishRound(s, guildID, game, actionLog, isMatchOver, winner)
+	case engine.TimeoutForfeitRound:
+		// whoever timed out is left without an action, which forfeits the round
+		lockActionsForRound(s, game)
+		actionLog, isMatchOver, winner := game.NextStateFromActions()
+		finishRound(s, guildID, game, actionLog, isMatchOver, winner)
+	}
+}
@@ -2,17 +2,53 @@ package main
 
 import (
 	"fmt"
+	"math/rand/v2"
+	"strconv"
 
-	"github.com/bwmarrin/discordgo"
+	"hwacha/bagh/ai"
+	"hwacha/bagh/engine"
 )
 
 func runGameCommandLine() {
-	var p1ActionString, p2ActionString string
-	var p1Action, p2Action Action = Unchosen, Unchosen
+	names := [2]string{"p1", "p2"}
 
-	p1 := NewPlayer(&discordgo.User{ID: "1"})
-	p2 := NewPlayer(&discordgo.User{ID: "2"})
-	game := MatchOngoing{Thread: nil, LastRoundMessageID: "", Challenger: p1, Challengee: p2, Round: 1}
+	againstAI := AILevelName != ""
+	level, found := ai.ParseLevel(AILevelName)
+	if againstAI && !found {
+		fmt.Println("Unknown AI level: " + AILevelName)
+		return
+	}
+	if againstAI {
+		names[1] = "BAGH"
+		// the equilibrium level plays from solved tables where there are some
+		if _, err := ai.LoadStrategyTables(strategyDir()); err != nil {
+			fmt.Println("Couldn't load strategy tables:", err)
+		}
+	}
+
+	rules, found := engine.PresetByName(RulesetName)
+	if !found {
+		fmt.Println("Unknown ruleset: " + RulesetName)
+		return
+	}
+	if err := rules.Validate(); err != nil {
+		fmt.Println("Invalid ruleset:", err)
+		return
+	}
+	state := engine.NewState(rules)
+
+	seed := Seed
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	rng := engine.NewRand(seed)
+	// the AI draws from its own stream of the seed, as it does on Discord
+	aiRNG := rand.New(rand.NewPCG(seed, 1))
+	fmt.Println("Seed: " + strconv.FormatUint(seed, 10))
+	fmt.Println("Rules: " + rules.Name + " (" + rules.Describe() + ")")
+	if againstAI {
+		fmt.Println("Opponent: BAGH (" + level.Title() + ")")
+	}
 
 	redact := func() {
 		fmt.Print("\033[A")
@@ -21,20 +57,21 @@ func runGameCommandLine() {
 		fmt.Println()
 	}
 
-	for {
-		fmt.Println(game.ToString())
+	readAction := func(name string) engine.Action {
+		var actionString string
 		for {
-			fmt.Print("p1: ")
-			fmt.Scanln(&p1ActionString)
-			switch p1ActionString {
+			fmt.Print(name + ": ")
+			fmt.Scanln(&actionString)
+			var action engine.Action
+			switch actionString {
 			case "b", "boost":
-				p1Action = Boost
+				action = engine.Boost
 			case "a", "attack":
-				p1Action = Attack
+				action = engine.Attack
 			case "g", "guard":
-				p1Action = Guard
+				action = engine.Guard
 			case "h", "heal":
-				p1Action = Heal
+				action = engine.Heal
 			default:
 				fmt.Println("Invalid.")
 				continue
@@ -42,39 +79,31 @@ func runGameCommandLine() {
 			if Secret {
 				redact()
 			}
-			break
+			return action
 		}
+	}
 
-		for {
-			fmt.Print("p2: ")
-			fmt.Scanln(&p2ActionString)
-			switch p2ActionString {
-			case "b", "boost":
-				p2Action = Boost
-			case "a", "attack":
-				p2Action = Attack
-			case "g", "guard":
-				p2Action = Guard
-			case "h", "heal":
-				p2Action = Heal
-			default:
-				fmt.Println("Invalid.")
-				continue
-			}
-			if Secret {
-				redact()
-			}
-			break
-		}
+	for {
+		fmt.Println(state.ToString(names))
 
-		game.Challenger.SetAction(p1Action)
-		game.Challengee.SetAction(p2Action)
+		var actions [2]engine.Action
+		if againstAI {
+			actions = [2]engine.Action{readAction(names[0]), ai.ChooseAt(level, state, 1, aiRNG)}
+		} else {
+			actions = [2]engine.Action{readAction(names[0]), readAction(names[1])}
+		}
 
-		actionLog, isOver, _ := game.NextStateFromActions()
+		var events []engine.Event
+		state, events = engine.Resolve(state, actions, rng)
 
-		fmt.Println(actionLog)
+		if JSON {
+			data, _ := engine.RenderJSON(events)
+			fmt.Println(string(data))
+		} else {
+			fmt.Println(engine.RenderPlain(events, names))
+		}
 
-		if isOver {
+		if isOver, _ := state.IsMatchOver(); isOver {
 			break
 		}
 	}
@@ -1,6 +1,13 @@
 package main
 
 import (
+	"slices"
+	"strconv"
+	"time"
+
+	"hwacha/bagh/ai"
+	"hwacha/bagh/engine"
+
 	"github.com/bwmarrin/discordgo"
 )
 
@@ -168,3 +175,204 @@ var rescindButton = []discordgo.MessageComponent{
 		},
 	},
 }
+
+var leaveQueueButton = []discordgo.MessageComponent{
+	discordgo.ActionsRow{
+		Components: []discordgo.MessageComponent{
+			discordgo.Button{
+				Label:    "Leave Queue",
+				Style:    discordgo.SecondaryButton,
+				Disabled: false,
+				CustomID: "queue_leave",
+			},
+		},
+	},
+}
+
+// the match's challenger is after the colon in the button's custom ID,
+// so the button keeps working when the match moves to a new thread
+func watchMatchButtonRow(game *MatchOngoing) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "Watch",
+					Style:    discordgo.SecondaryButton,
+					Disabled: false,
+					CustomID: "match_watch:" + game.Challenger.User.ID,
+					Emoji: &discordgo.ComponentEmoji{
+						Name: "👀",
+					},
+				},
+			},
+		},
+	}
+}
+
+func selectMenuOptions(labels []string, values []int, selected int) []discordgo.SelectMenuOption {
+	options := make([]discordgo.SelectMenuOption, len(values))
+	for i, value := range values {
+		options[i] = discordgo.SelectMenuOption{
+			Label:   labels[i],
+			Value:   strconv.Itoa(value),
+			Default: value == selected,
+		}
+	}
+	return options
+}
+
+var (
+	challengeTermsGamesToWin = []int{1, 3, 5}
+	challengeTermsStartingHP = []int{3, 6, 9}
+	challengeTermsMaxBoost   = []int{3, 6, 9}
+	// chosen by their index
+	challengeTermsClocks = []engine.RoundClock{
+		{},
+		{Limit: time.Minute, OnTimeout: engine.TimeoutGuard, MaxTimeouts: 3},
+		{Limit: time.Minute, OnTimeout: engine.TimeoutForfeitRound, MaxTimeouts: 3},
+		{Limit: 5 * time.Minute, OnTimeout: engine.TimeoutGuard, MaxTimeouts: 3},
+		{Limit: 5 * time.Minute, OnTimeout: engine.TimeoutForfeitRound, MaxTimeouts: 3},
+	}
+)
+
+func challengeTermsComponents(draft *ChallengeDraft) []discordgo.MessageComponent {
+	rules := draft.Rules
+	components := []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.SelectMenu{
+					CustomID:    "challenge_terms_length",
+					Placeholder: "Match length",
+					Options: selectMenuOptions(
+						[]string{"Best of 1", "First to 3 wins", "First to 5 wins"},
+						challengeTermsGamesToWin, rules.GamesToWin),
+				},
+			},
+		},
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.SelectMenu{
+					CustomID:    "challenge_terms_hp",
+					Placeholder: "Starting HP",
+					Options: selectMenuOptions(
+						[]string{"3 starting HP", "6 starting HP", "9 starting HP"},
+						challengeTermsStartingHP, rules.StartingHP),
+				},
+			},
+		},
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.SelectMenu{
+					CustomID:    "challenge_terms_boost",
+					Placeholder: "Boost cap",
+					Options: selectMenuOptions(
+						[]string{"Boost cap of 3", "Boost cap of 6", "Boost cap of 9"},
+						challengeTermsMaxBoost, rules.MaxBoost),
+				},
+			},
+		},
+	}
+
+	if draft.IsAgainstBAGH() {
+		levelLabels := make([]string, len(ai.Levels))
+		levelValues := make([]int, len(ai.Levels))
+		for i, level := range ai.Levels {
+			levelLabels[i] = level.Title() + " difficulty"
+			levelValues[i] = int(level)
+		}
+		components = append(components, discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.SelectMenu{
+					CustomID:    "challenge_terms_difficulty",
+					Placeholder: "Difficulty",
+					Options:     selectMenuOptions(levelLabels, levelValues, int(draft.AILevel)),
+				},
+			},
+		})
+	} else {
+		// BAGH never runs out of time, so only matches between people get a clock.
+		// Discord allows five rows, so it takes the difficulty's place.
+		clockLabels := make([]string, len(challengeTermsClocks))
+		clockValues := make([]int, len(challengeTermsClocks))
+		for i, clock := range challengeTermsClocks {
+			clockLabels[i] = clock.Describe()
+			clockValues[i] = i
+		}
+		components = append(components, discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.SelectMenu{
+					CustomID:    "challenge_terms_clock",
+					Placeholder: "Round clock",
+					Options:     selectMenuOptions(clockLabels, clockValues, slices.Index(challengeTermsClocks, rules.Clock)),
+				},
+			},
+		})
+	}
+
+	return append(components,
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "Send Challenge",
+					Style:    discordgo.PrimaryButton,
+					Disabled: false,
+					CustomID: "challenge_send",
+				},
+				discordgo.Button{
+					Label:    "Cancel",
+					Style:    discordgo.SecondaryButton,
+					Disabled: false,
+					CustomID: "challenge_cancel",
+				},
+			},
+		},
+	)
+}
+
+// the buttons step through the match with the ID after the first colon,
+// to the step after the second. Each button's ID ends with its name,
+// since Discord won't take two buttons with the same ID.
+func replayStepButtonRow(matchID string, step int, steps int) []discordgo.MessageComponent {
+	button := func(label string, target int, disabled bool) discordgo.Button {
+		return discordgo.Button{
+			Label:    label,
+			Style:    discordgo.SecondaryButton,
+			Disabled: disabled,
+			CustomID: "replay_step:" + matchID + ":" + strconv.Itoa(target) + ":" + label,
+		}
+	}
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				button("First", 0, step <= 0),
+				button("Previous", step-1, step <= 0),
+				button("Next", step+1, step >= steps-1),
+				button("Last", steps-1, step >= steps-1),
+			},
+		},
+	}
+}
+
+const leaderboardPageSize = 10
+
+// the page to go to is after the colon in each button's custom ID
+func leaderboardPageButtonRow(page int, pages int) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "Previous",
+					Style:    discordgo.SecondaryButton,
+					Disabled: page <= 0,
+					CustomID: "leaderboard_page:" + strconv.Itoa(page-1),
+				},
+				discordgo.Button{
+					Label:    "Next",
+					Style:    discordgo.SecondaryButton,
+					Disabled: page >= pages-1,
+					CustomID: "leaderboard_page:" + strconv.Itoa(page+1),
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,18 @@
+package engine
+
+type Action int
+
+const (
+	Boost Action = iota
+	Attack
+	Guard
+	Heal
+	Unchosen
+)
+
+var ActionStrings = map[Action]string{
+	Boost:  "⬆️ **BOOST** ⬆️",
+	Attack: "⚔️ **ATTACK** ⚔️",
+	Guard:  "🛡️ **GUARD** 🛡️",
+	Heal:   "✨ **HEAL** ✨",
+}
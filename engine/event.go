@@ -0,0 +1,169 @@
+package engine
+
+// Event is something that happened while resolving a round.
+// Players are referred to by their index in State.Players.
+type Event interface {
+	isEvent()
+}
+
+// the shield mending roll at the start of the round succeeded,
+// or the shield's damage fell to 0 at the end of the round
+type ShieldMended struct {
+	Player  int
+	Decayed bool
+}
+
+type ShieldStillBroken struct {
+	Player int
+	Damage int
+}
+
+type BoostGained struct {
+	Player int
+	Boost  int
+}
+
+// boosting at the boost cap preserves the boost without raising it
+type BoostCapped struct {
+	Player int
+	Boost  int
+}
+
+type AttackLanded struct {
+	Attacker     int
+	Defender     int
+	Damage       int
+	Boost        int
+	WithPriority bool
+	DefenderHP   int
+}
+
+// both players attacked and the defender's higher priority cancelled the attack
+type AttackNullifiedByPriority struct {
+	Attacker int
+	Defender int
+	Boost    int
+}
+
+// the guard was chosen, but the shield was broken and didn't stop the attack
+type GuardFailed struct {
+	Attacker int
+	Guarder  int
+}
+
+type GuardSucceeded struct {
+	Attacker    int
+	Guarder     int
+	AttackBoost int
+	GuardBoost  int
+}
+
+type GuardWasted struct {
+	Guarder int
+}
+
+type ShieldBroke struct {
+	Player int
+	Damage int
+}
+
+// the attacker's priority cancelled out all the priority a guard would have gained
+type PriorityDenied struct {
+	Player   int
+	Dampener int
+}
+
+type PriorityGained struct {
+	Player     int
+	Priority   int
+	BoostBonus int
+	Dampened   bool
+	Dampener   int
+}
+
+type PriorityRetained struct {
+	Player     int
+	Priority   int
+	BoostBonus int
+	Dampened   bool
+	Dampener   int
+}
+
+type PriorityFell struct {
+	Player   int
+	Priority int
+}
+
+// MendOdds is the N in the 1 in N chance of the shield mending next round
+type ShieldDecayed struct {
+	Player   int
+	Damage   int
+	MendOdds int
+}
+
+type HealInterrupted struct {
+	Healer   int
+	Attacker int
+}
+
+// Amount is 0 if the healer was already at the overheal cap.
+// ThroughAttack is set when priority kept Attacker from interrupting the heal.
+type HealApplied struct {
+	Healer        int
+	Amount        int
+	HP            int
+	Overheal      bool
+	ThroughAttack bool
+	Attacker      int
+}
+
+type BoostExpended struct {
+	Player int
+	Boost  int
+}
+
+// Winner is NoWinner if both players fell in the same round
+type GameWon struct {
+	Winner int
+	Wins   [2]int
+	// how the players stood when the game ended, before the next one was set up
+	Final [2]Player `json:"-"`
+}
+
+// the player gave up their action, letting the other's play out unopposed
+type RoundForfeited struct {
+	Player int
+}
+
+// Winner is NoWinner if both players reached the win count together
+type MatchWon struct {
+	Winner int
+	Wins   [2]int
+}
+
+type GameStarted struct {
+	Game int
+}
+
+func (ShieldMended) isEvent()              {}
+func (ShieldStillBroken) isEvent()         {}
+func (BoostGained) isEvent()               {}
+func (BoostCapped) isEvent()               {}
+func (AttackLanded) isEvent()              {}
+func (AttackNullifiedByPriority) isEvent() {}
+func (GuardFailed) isEvent()               {}
+func (GuardSucceeded) isEvent()            {}
+func (GuardWasted) isEvent()               {}
+func (ShieldBroke) isEvent()               {}
+func (PriorityDenied) isEvent()            {}
+func (PriorityGained) isEvent()            {}
+func (PriorityRetained) isEvent()          {}
+func (PriorityFell) isEvent()              {}
+func (ShieldDecayed) isEvent()             {}
+func (HealInterrupted) isEvent()           {}
+func (HealApplied) isEvent()               {}
+func (BoostExpended) isEvent()             {}
+func (GameWon) isEvent()                   {}
+func (RoundForfeited) isEvent()            {}
+func (MatchWon) isEvent()                  {}
+func (GameStarted) isEvent()               {}
@@ -0,0 +1,309 @@
+package engine
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MatchNotation is a match written down the way chess games are in PGN:
+// a header of tags, then the moves, a line per game.
+//
+//	[Challenger "ann"]
+//	[Challengee "bob"]
+//	...
+//
+//	1. B A  2. A G*  3. H+ A
+//	1. ...
+//
+// Each round is numbered within its game, then gives both players' actions,
+// B, A, G or H, the challenger's first. An action ends with + if the player's
+// broken shield mended at the start of the round, and * if their shield broke
+// during it. A player who forfeited the round is written X, with the same
+// annotations.
+type MatchNotation struct {
+	Players [2]string
+	Rules   Ruleset
+	Seed    uint64
+	Date    time.Time
+	// "1-0" or "0-1" for a win, "1/2-1/2" for a draw, or "*" if unfinished
+	Result string
+	// how the match ended, if not by being played out, like "forfeit"
+	Termination string
+	Rounds      []RoundRecord
+}
+
+const notationDateLayout = "2006.01.02"
+
+var actionLetters = map[Action]string{
+	Boost:    "B",
+	Attack:   "A",
+	Guard:    "G",
+	Heal:     "H",
+	Unchosen: "X",
+}
+
+var timeoutPolicyNames = map[TimeoutPolicy]string{
+	TimeoutGuard:        "guard",
+	TimeoutForfeitRound: "forfeit-round",
+}
+
+// MatchResult writes the winner of a match, or NoWinner for a draw, as a result tag.
+func MatchResult(winner int) string {
+	switch winner {
+	case 0:
+		return "1-0"
+	case 1:
+		return "0-1"
+	}
+	return "1/2-1/2"
+}
+
+// String writes the match down in notation.
+func (match MatchNotation) String() string {
+	var b strings.Builder
+	tag := func(name string, value string) {
+		b.WriteString("[" + name + " " + strconv.Quote(value) + "]\n")
+	}
+
+	rules := match.Rules
+	tag("Challenger", match.Players[0])
+	tag("Challengee", match.Players[1])
+	if !match.Date.IsZero() {
+		tag("Date", match.Date.UTC().Format(notationDateLayout))
+	}
+	tag("Seed", strconv.FormatUint(match.Seed, 10))
+	tag("Result", cmp.Or(match.Result, "*"))
+	if match.Termination != "" {
+		tag("Termination", match.Termination)
+	}
+	tag("Rules", rules.Name)
+	tag("GamesToWin", strconv.Itoa(rules.GamesToWin))
+	tag("StartingHP", strconv.Itoa(rules.StartingHP))
+	tag("MaxHP", strconv.Itoa(rules.MaxHP))
+	tag("MaxBoost", strconv.Itoa(rules.MaxBoost))
+	tag("MendBase", strconv.Itoa(rules.MendBase))
+	if rules.Clock.IsSet() {
+		tag("TimeControl", strconv.Itoa(int(rules.Clock.Limit/time.Second))+"/"+
+			timeoutPolicyNames[rules.Clock.OnTimeout]+"/"+strconv.Itoa(rules.Clock.MaxTimeouts))
+	}
+	b.WriteString("\n")
+
+	state := NewState(rules)
+	line := []string{}
+	for _, round := range match.Rounds {
+		broke := [2]bool{}
+		next, events := ResolveRolled(state, round.Actions, round.Mended)
+		for _, event := range events {
+			if shieldBroke, isShieldBroke := event.(ShieldBroke); isShieldBroke {
+				broke[shieldBroke.Player] = true
+			}
+		}
+
+		moves := [2]string{}
+		for i := range moves {
+			moves[i] = actionLetters[round.Actions[i]]
+			if round.Mended[i] && state.Players[i].ShieldBreakCounter > 0 {
+				moves[i] += "+"
+			}
+			if broke[i] {
+				moves[i] += "*"
+			}
+		}
+		line = append(line, strconv.Itoa(state.Round)+". "+moves[0]+" "+moves[1])
+
+		if next.Game != state.Game {
+			b.WriteString(strings.Join(line, "  ") + "\n")
+			line = line[:0]
+		}
+		state = next
+	}
+	if len(line) > 0 {
+		b.WriteString(strings.Join(line, "  ") + "\n")
+	}
+	return b.String()
+}
+
+// ParseNotation reads a match written in notation, replaying its rounds
+// to reconstruct each one's state and checking its annotations and result
+// agree with how the rounds play out.
+func ParseNotation(text string) (MatchNotation, error) {
+	match := MatchNotation{Result: "*"}
+	tags := map[string]string{}
+	moves := []string{}
+	for n, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "[") {
+			moves = append(moves, strings.Fields(line)...)
+			continue
+		}
+		name, value, found := strings.Cut(strings.TrimSuffix(strings.TrimPrefix(line, "["), "]"), " ")
+		if !found {
+			return match, fmt.Errorf("line %d: tag has no value", n+1)
+		}
+		unquoted, err := strconv.Unquote(strings.TrimSpace(value))
+		if err != nil {
+			return match, fmt.Errorf("line %d: tag value isn't quoted", n+1)
+		}
+		tags[name] = unquoted
+	}
+
+	if err := match.readTags(tags); err != nil {
+		return match, err
+	}
+	if err := match.Rules.Validate(); err != nil {
+		return match, err
+	}
+	if err := match.readMoves(moves); err != nil {
+		return match, err
+	}
+	return match, nil
+}
+
+func (match *MatchNotation) readTags(tags map[string]string) error {
+	match.Players = [2]string{tags["Challenger"], tags["Challengee"]}
+	match.Termination = tags["Termination"]
+
+	if result, found := tags["Result"]; found {
+		switch result {
+		case "1-0", "0-1", "1/2-1/2", "*":
+			match.Result = result
+		default:
+			return errors.New("unknown result " + result)
+		}
+	}
+
+	var err error
+	if date, found := tags["Date"]; found {
+		if match.Date, err = time.Parse(notationDateLayout, date); err != nil {
+			return errors.New("date isn't written YYYY.MM.DD")
+		}
+	}
+	if seed, found := tags["Seed"]; found {
+		if match.Seed, err = strconv.ParseUint(seed, 10, 64); err != nil {
+			return errors.New("seed isn't a number")
+		}
+	}
+
+	// the numbers override the named ruleset's, so custom rules read back the same
+	rules, found := PresetByName(tags["Rules"])
+	if !found {
+		rules = Ruleset{Name: tags["Rules"], MendBase: Classic.MendBase}
+	}
+	for name, field := range map[string]*int{
+		"GamesToWin": &rules.GamesToWin,
+		"StartingHP": &rules.StartingHP,
+		"MaxHP":      &rules.MaxHP,
+		"MaxBoost":   &rules.MaxBoost,
+		"MendBase":   &rules.MendBase,
+	} {
+		value, found := tags[name]
+		if !found {
+			continue
+		}
+		if *field, err = strconv.Atoi(value); err != nil {
+			return errors.New(name + " isn't a number")
+		}
+	}
+
+	if timeControl, found := tags["TimeControl"]; found {
+		parts := strings.Split(timeControl, "/")
+		if len(parts) != 3 {
+			return errors.New("time control isn't written seconds/policy/timeouts")
+		}
+		seconds, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return errors.New("time control's seconds aren't a number")
+		}
+		rules.Clock.Limit = time.Duration(seconds) * time.Second
+		found := false
+		for policy, name := range timeoutPolicyNames {
+			if name == parts[1] {
+				rules.Clock.OnTimeout, found = policy, true
+			}
+		}
+		if !found {
+			return errors.New("unknown timeout policy " + parts[1])
+		}
+		if rules.Clock.MaxTimeouts, err = strconv.Atoi(parts[2]); err != nil {
+			return errors.New("time control's timeouts aren't a number")
+		}
+	}
+
+	match.Rules = rules
+	return nil
+}
+
+func (match *MatchNotation) readMoves(moves []string) error {
+	state := NewState(match.Rules)
+	for len(moves) > 0 {
+		if len(moves) < 3 {
+			return fmt.Errorf("round %s is missing an action", moves[0])
+		}
+		number, first, second := moves[0], moves[1], moves[2]
+		moves = moves[3:]
+
+		n := len(match.Rounds) + 1
+		if number != strconv.Itoa(state.Round)+"." {
+			return fmt.Errorf("round %d is numbered %s, not %d.", n, number, state.Round)
+		}
+		if isMatchOver, _ := state.IsMatchOver(); isMatchOver {
+			return fmt.Errorf("round %d comes after the match is over", n)
+		}
+
+		round := RoundRecord{}
+		annotatedBroke := [2]bool{}
+		for i, move := range [2]string{first, second} {
+			letter, annotations := move[:1], move[1:]
+			found := false
+			for action, actionLetter := range actionLetters {
+				if actionLetter == letter {
+					round.Actions[i], found = action, true
+				}
+			}
+			if !found {
+				return fmt.Errorf("round %d has an unknown action %s", n, move)
+			}
+			if strings.HasPrefix(annotations, "+") {
+				if state.Players[i].ShieldBreakCounter == 0 {
+					return fmt.Errorf("round %d mends a shield that isn't broken", n)
+				}
+				round.Mended[i] = true
+				annotations = annotations[1:]
+			}
+			if annotations == "*" {
+				annotatedBroke[i] = true
+			} else if annotations != "" {
+				return fmt.Errorf("round %d has an unknown annotation %s", n, move)
+			}
+		}
+		var events []Event
+		state, events = ResolveRolled(state, round.Actions, round.Mended)
+		broke := [2]bool{}
+		for _, event := range events {
+			if shieldBroke, isShieldBroke := event.(ShieldBroke); isShieldBroke {
+				broke[shieldBroke.Player] = true
+			}
+		}
+		for i := range broke {
+			if broke[i] && !annotatedBroke[i] {
+				return fmt.Errorf("round %d breaks a shield without saying so", n)
+			}
+			if annotatedBroke[i] && !broke[i] {
+				return fmt.Errorf("round %d says a shield broke, but it didn't", n)
+			}
+		}
+
+		round.State = state
+		match.Rounds = append(match.Rounds, round)
+	}
+
+	// a match can end early, by forfeit say, but one played out has to end as it says
+	if isMatchOver, winner := state.IsMatchOver(); isMatchOver && match.Result != MatchResult(winner) {
+		return fmt.Errorf("the match ends %s, not %s", MatchResult(winner), match.Result)
+	}
+	return nil
+}
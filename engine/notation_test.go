@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNotationReadsBackWhatItWrites(t *testing.T) {
+	rules := Classic
+	rules.Clock = RoundClock{Limit: time.Minute, OnTimeout: TimeoutForfeitRound, MaxTimeouts: 3}
+
+	// a shield broken and mended, and each player forfeiting a round
+	actions := [][2]Action{
+		{Boost, Guard},
+		{Attack, Guard},
+		{Attack, Guard},
+		{Unchosen, Attack},
+		{Attack, Unchosen},
+		{Attack, Heal},
+	}
+	mended := [][2]bool{{}, {}, {false, true}, {}, {}, {}}
+
+	state := NewState(rules)
+	match := MatchNotation{Players: [2]string{"ann", "bob"}, Rules: rules, Seed: 7}
+	for n := range actions {
+		round := RoundRecord{Actions: actions[n], Mended: mended[n]}
+		state, _ = ResolveRolled(state, round.Actions, round.Mended)
+		round.State = state
+		match.Rounds = append(match.Rounds, round)
+	}
+
+	text := match.String()
+	if want := "1. B G  2. A G*  3. A G+  4. X A  5. A X  6. A H\n"; !strings.HasSuffix(text, want) {
+		t.Fatalf("moves are written\n%s\nwant them to end\n%s", text, want)
+	}
+
+	parsed, err := ParseNotation(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Rules != rules || parsed.Seed != match.Seed || parsed.Players != match.Players {
+		t.Errorf("tags read back as %+v, want %+v", parsed, match)
+	}
+	if len(parsed.Rounds) != len(match.Rounds) {
+		t.Fatalf("read back %d rounds, want %d", len(parsed.Rounds), len(match.Rounds))
+	}
+	for n := range match.Rounds {
+		if parsed.Rounds[n] != match.Rounds[n] {
+			t.Errorf("round %d read back as %+v, want %+v", n+1, parsed.Rounds[n], match.Rounds[n])
+		}
+	}
+}
+
+func TestNotationRejectsMovesThatDidntHappen(t *testing.T) {
+	header := "[Rules \"classic\"]\n\n"
+	tests := map[string]string{
+		"an unknown action":            "1. B F",
+		"an unannotated broken shield": "1. B G  2. A G",
+		"a shield that didn't break":   "1. A G*",
+		"a mend with no broken shield": "1. A+ G",
+		"a misnumbered round":          "2. B B",
+		"a missing action":             "1. B",
+	}
+	for name, moves := range tests {
+		if _, err := ParseNotation(header + moves); err == nil {
+			t.Errorf("read %s without an error", name)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package engine
+
+import "fmt"
+
+// RoundRecord is one resolved round of a match: what both players did,
+// how the shield mending rolls went, and the state the round left behind.
+// Resolving the previous state with ResolveRolled reproduces it.
+// A player whose action is Unchosen forfeited the round.
+type RoundRecord struct {
+	Actions [2]Action
+	Mended  [2]bool
+	State   State
+}
+
+// Replay resolves the recorded rounds in order from the start of a match
+// under rules, checking that each one leads to the state it recorded.
+// visit, if it isn't nil, is called for each round with the state before it
+// and the events it produced.
+func Replay(rules Ruleset, rounds []RoundRecord, visit func(before State, round RoundRecord, events []Event)) error {
+	state := NewState(rules)
+	for n, round := range rounds {
+		if isMatchOver, _ := state.IsMatchOver(); isMatchOver {
+			return fmt.Errorf("round %d comes after the match is over", n+1)
+		}
+		for _, action := range round.Actions {
+			if action < Boost || action > Unchosen {
+				return fmt.Errorf("round %d has an unknown action", n+1)
+			}
+		}
+
+		next, events := ResolveRolled(state, round.Actions, round.Mended)
+		if next != round.State {
+			return fmt.Errorf("round %d doesn't lead to the state it recorded", n+1)
+		}
+		if visit != nil {
+			visit(state, round, events)
+		}
+		state = next
+	}
+	return nil
+}
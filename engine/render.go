@@ -0,0 +1,168 @@
+package engine
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+)
+
+type textStyle struct {
+	actions map[Action]string
+	bold    func(string) string
+	heading func(string) string
+}
+
+var markdownStyle = textStyle{
+	actions: ActionStrings,
+	bold:    func(s string) string { return "**" + s + "**" },
+	heading: func(s string) string { return "# " + s },
+}
+
+var plainStyle = textStyle{
+	actions: map[Action]string{
+		Boost:  "BOOST",
+		Attack: "ATTACK",
+		Guard:  "GUARD",
+		Heal:   "HEAL",
+	},
+	bold:    func(s string) string { return s },
+	heading: func(s string) string { return "== " + s + " ==" },
+}
+
+// RenderMarkdown renders events as the action log posted to Discord.
+// names[i] is how player i is referred to.
+func RenderMarkdown(events []Event, names [2]string) string {
+	return markdownStyle.render(events, names)
+}
+
+// RenderPlain renders events as unformatted text, for terminals.
+func RenderPlain(events []Event, names [2]string) string {
+	return plainStyle.render(events, names)
+}
+
+type jsonEvent struct {
+	Type string `json:"type"`
+	Data Event  `json:"data"`
+}
+
+// RenderJSON renders events as a JSON array, tagging each with its type name.
+func RenderJSON(events []Event) ([]byte, error) {
+	tagged := make([]jsonEvent, len(events))
+	for i, event := range events {
+		tagged[i] = jsonEvent{Type: reflect.TypeOf(event).Name(), Data: event}
+	}
+	return json.Marshal(tagged)
+}
+
+func (style textStyle) render(events []Event, names [2]string) string {
+	b := style.bold
+	itoa := strconv.Itoa
+
+	log := ""
+	for _, event := range events {
+		switch e := event.(type) {
+		case ShieldMended:
+			log += "- " + names[e.Player] + "'s shield is " + b("mended") + "!\n"
+		case ShieldStillBroken:
+			log += "- " + names[e.Player] + "'s shield remains " + b("broken") + ".\n"
+		case BoostGained:
+			log += "- " + names[e.Player] + " " + style.actions[Boost] + "s to " + b(itoa(e.Boost)) + ".\n"
+		case BoostCapped:
+			log += "- " + names[e.Player] + " " + style.actions[Boost] + "s, preserving a boost of " + b(itoa(e.Boost)) + ".\n"
+		case AttackNullifiedByPriority:
+			attackString := style.actions[Attack]
+			if e.Boost > 0 {
+				attackString = "boosted " + attackString
+			}
+			log += "- " + names[e.Defender] + "'s counterattack renders " + names[e.Attacker] + "'s " + attackString + " " + b("impotent") + ".\n"
+		case GuardFailed:
+			log += "- " + names[e.Attacker] + " attacks, and " + names[e.Guarder] + " " + style.actions[Guard] + "s, but the shield is " + b("broken") + ".\n"
+		case GuardSucceeded:
+			attackString := style.actions[Attack] + "s"
+			if e.AttackBoost > 0 {
+				attackString += " with a boost of " + itoa(e.AttackBoost)
+			}
+			guardString := style.actions[Guard] + "s"
+			if e.GuardBoost > 0 {
+				guardString += " with a boost of " + itoa(e.GuardBoost)
+			}
+			log += "- " + names[e.Attacker] + " " + attackString + ", but " + names[e.Guarder] + " " + guardString + " and " + b("prevents damage") + ".\n"
+		case ShieldBroke:
+			log += "- " + names[e.Player] + "'s shield " + b("breaks") + "! Its damage is at " + itoa(e.Damage) + ".\n"
+		case PriorityDenied:
+			log += "- Because of " + names[e.Dampener] + "'s priority, " + names[e.Player] + " gains no priority.\n"
+		case PriorityGained:
+			log += style.priorityChange(names, e.Player, " gains priority", " up to ", e.Priority, e.BoostBonus, e.Dampened, e.Dampener)
+		case PriorityRetained:
+			log += style.priorityChange(names, e.Player, " retains priority", " at ", e.Priority, e.BoostBonus, e.Dampened, e.Dampener)
+		case AttackLanded:
+			log += "- " + names[e.Attacker] + " " + style.actions[Attack] + "s for "
+			if e.Boost > 0 {
+				log += "a boosted "
+			}
+			log += b(itoa(e.Damage)) + " damage"
+			if e.WithPriority {
+				log += " with priority"
+			}
+			log += ".\n"
+		case GuardWasted:
+			log += "- " + names[e.Guarder] + " " + style.actions[Guard] + "s to " + b("no effect") + ".\n"
+		case HealInterrupted:
+			log += "- " + names[e.Healer] + "'s " + style.actions[Heal] + "ing is " + b("interrupted") + " by " + names[e.Attacker] + "'s attack.\n"
+		case HealApplied:
+			log += "- " + names[e.Healer] + " " + style.actions[Heal] + "s"
+			if e.ThroughAttack {
+				log += ", with " + b("priority preventing interruption") + " from " + names[e.Attacker] + "'s attack,"
+			}
+			if e.Amount == 0 {
+				log += " to no effect.\n"
+			} else {
+				log += " by " + b(itoa(e.Amount)) + " to "
+				if e.Overheal {
+					log += "an overheal of "
+				}
+				log += b(itoa(e.HP)) + ".\n"
+			}
+		case BoostExpended:
+			log += "- " + names[e.Player] + "'s boost is " + b("expended to 0") + ".\n"
+		case PriorityFell:
+			log += "- " + names[e.Player] + "'s priority " + b("falls to "+itoa(e.Priority)) + ".\n"
+		case ShieldDecayed:
+			log += "- The chance of " + names[e.Player] + "'s shield mending next turn is " + b("1 in "+itoa(e.MendOdds)) + ".\n"
+		case GameWon:
+			if e.Winner == NoWinner {
+				log += "- Both players have lost all health in the same turn, resulting in a " + b("draw") + "."
+			} else {
+				log += "- " + names[e.Winner] + " secures " + b("victory") + "!"
+			}
+			log += "\n- The score is | " +
+				names[0] + " " + b(itoa(e.Wins[0])) + " | " +
+				names[1] + " " + b(itoa(e.Wins[1])) + " |\n"
+		case RoundForfeited:
+			log += "- " + names[e.Player] + " " + b("forfeits") + " the round.\n"
+		case MatchWon:
+			log += "- The match has ended."
+		case GameStarted:
+			log += style.heading("Game "+itoa(e.Game)) + "\n"
+		}
+	}
+	return log
+}
+
+func (style textStyle) priorityChange(names [2]string, player int, verb string, preposition string, priority int, boostBonus int, dampened bool, dampener int) string {
+	line := "- " + names[player] + verb
+
+	if boostBonus > 0 {
+		line += " boosted by " + strconv.Itoa(boostBonus)
+
+		if dampened {
+			line += " but"
+		}
+	}
+
+	if dampened {
+		line += " dampened by 1 by " + names[dampener] + "'s priority"
+	}
+
+	return line + preposition + style.bold(strconv.Itoa(priority)) + ".\n"
+}
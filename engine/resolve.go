@@ -0,0 +1,352 @@
+package engine
+
+import (
+	"math/rand/v2"
+)
+
+// NewSource returns the source of randomness for the rules of a match played with seed.
+// Its state can be saved with MarshalBinary to pick the match back up later.
+func NewSource(seed uint64) *rand.PCG {
+	return rand.NewPCG(seed, 0)
+}
+
+// NewRand returns a generator drawing from NewSource(seed).
+func NewRand(seed uint64) *rand.Rand {
+	return rand.New(NewSource(seed))
+}
+
+// Resolve applies both players' actions to state and returns the next state
+// along with the events that happened, in the order they should be told.
+// rng is only drawn from to roll for mending broken shields, so a match
+// can be replayed exactly from its seed and its actions.
+func Resolve(state State, actions [2]Action, rng *rand.Rand) (State, []Event) {
+	return ResolveRolled(state, actions, RollMends(state, rng))
+}
+
+// RollMends rolls for mending each broken shield at the start of a round,
+// the same way Resolve does, so that the rolls can be recorded.
+func RollMends(state State, rng *rand.Rand) [2]bool {
+	mended := [2]bool{}
+	for i, player := range state.Players {
+		if player.ShieldBreakCounter > 0 {
+			roll := rng.Float32()
+			mended[i] = roll < 1.0/float32(state.Rules.MendOdds(player.ShieldBreakCounter))
+		}
+	}
+	return mended
+}
+
+// MendOutcome is one way the shield mending rolls at the start of a round can go.
+type MendOutcome struct {
+	Mended      [2]bool
+	Probability float64
+}
+
+// MendOutcomes lists every way the shield mending rolls can go in state,
+// for callers that need to weigh each one instead of rolling.
+func MendOutcomes(state State) []MendOutcome {
+	outcomes := []MendOutcome{{Probability: 1}}
+	for i, player := range state.Players {
+		if player.ShieldBreakCounter == 0 {
+			continue
+		}
+		chance := 1.0 / float64(state.Rules.MendOdds(player.ShieldBreakCounter))
+		split := make([]MendOutcome, 0, 2*len(outcomes))
+		for _, outcome := range outcomes {
+			mended := outcome
+			mended.Mended[i] = true
+			mended.Probability *= chance
+			stillBroken := outcome
+			stillBroken.Probability *= 1 - chance
+			split = append(split, mended, stillBroken)
+		}
+		outcomes = split
+	}
+	return outcomes
+}
+
+// ResolveRolled is Resolve with the shield mending rolls already decided.
+// mended[i] is ignored unless player i's shield is broken.
+// A player whose action is Unchosen forfeits the round and does nothing.
+func ResolveRolled(state State, actions [2]Action, mended [2]bool) (State, []Event) {
+	gainedOrRetainedPriority := make(map[*Player]bool)
+	shieldJustBroke := make(map[*Player]bool)
+
+	rules := state.Rules
+	players := [2]*Player{&state.Players[0], &state.Players[1]}
+
+	events := []Event{}
+
+	// Initial Phase
+	for i, player := range players {
+		playerAction := actions[i]
+
+		if playerAction == Unchosen {
+			events = append(events, RoundForfeited{Player: i})
+		}
+
+		if player.ShieldBreakCounter > 0 {
+			if mended[i] {
+				player.ShieldBreakCounter = 0
+			}
+
+			if player.ShieldBreakCounter == 0 {
+				events = append(events, ShieldMended{Player: i})
+			} else {
+				events = append(events, ShieldStillBroken{Player: i, Damage: player.ShieldBreakCounter})
+			}
+		}
+
+		if playerAction == Boost {
+			if player.Boost < rules.MaxBoost {
+				player.Boost += 1
+				events = append(events, BoostGained{Player: i, Boost: player.Boost})
+			} else {
+				events = append(events, BoostCapped{Player: i, Boost: player.Boost})
+			}
+		}
+	}
+
+	type ActionInfo struct {
+		Agent   int
+		Patient int
+	}
+
+	playerRelations := [2]ActionInfo{
+		{
+			Agent:   0,
+			Patient: 1,
+		},
+		{
+			Agent:   1,
+			Patient: 0,
+		},
+	}
+
+	delayed := []Event{}
+
+	// Middle Phase
+	for _, playerRelation := range playerRelations {
+		agentIndex := playerRelation.Agent
+		patientIndex := playerRelation.Patient
+
+		agent := players[agentIndex]
+		patient := players[patientIndex]
+
+		agentAction := actions[agentIndex]
+		patientAction := actions[patientIndex]
+
+		agentHasPriority := agent.Priority > patient.Priority
+		patientHasPriority := patient.Priority > agent.Priority
+
+		// positive if agent has more boost
+		// negative if patient has more boost
+		// 0 if equal boost
+		boostDifferential := agent.Boost - patient.Boost
+
+		switch agentAction {
+		case Attack:
+			attackGoesThrough := true
+			switch patientAction {
+			case Attack:
+				if patientHasPriority { // attack has no effect
+					attackGoesThrough = false
+					delayed = append(delayed, AttackNullifiedByPriority{
+						Attacker: agentIndex,
+						Defender: patientIndex,
+						Boost:    agent.Boost,
+					})
+				}
+			case Guard:
+				if patient.ShieldBreakCounter > 0 { // shield is broken
+					events = append(events, GuardFailed{Attacker: agentIndex, Guarder: patientIndex})
+				} else { // shield not broken
+					attackGoesThrough = false
+					events = append(events, GuardSucceeded{
+						Attacker:    agentIndex,
+						Guarder:     patientIndex,
+						AttackBoost: agent.Boost,
+						GuardBoost:  patient.Boost,
+					})
+					// agent has higher boost
+					if boostDifferential > 0 {
+						patient.ShieldBreakCounter = boostDifferential
+						shieldJustBroke[patient] = true
+						events = append(events, ShieldBroke{Player: patientIndex, Damage: patient.ShieldBreakCounter})
+					} else {
+						oldPriority := patient.Priority
+						totalPriorityGain := 1 // base gain from effective guard
+
+						priorityIsDampened := agent.Priority > 0
+						if priorityIsDampened {
+							// agent's priority dampens priority gain by 1,
+							// which can happen for N potential turns,
+							// preserving payoff equivalence
+							totalPriorityGain -= 1
+						}
+						totalPriorityGain += -boostDifferential
+						patient.Priority += max(0, totalPriorityGain)
+						// patient gains or retains priority
+
+						if oldPriority == patient.Priority {
+							events = append(events, PriorityDenied{Player: patientIndex, Dampener: agentIndex})
+						} else {
+							// account for overcounted priority w/ depreciation
+							// now instead of later, for the sake of log coherence
+							if oldPriority > 0 {
+								patient.Priority -= 1
+							}
+
+							if oldPriority == patient.Priority {
+								events = append(events, PriorityRetained{
+									Player:     patientIndex,
+									Priority:   patient.Priority,
+									BoostBonus: max(0, -boostDifferential),
+									Dampened:   priorityIsDampened,
+									Dampener:   agentIndex,
+								})
+							} else {
+								events = append(events, PriorityGained{
+									Player:     patientIndex,
+									Priority:   patient.Priority,
+									BoostBonus: max(0, -boostDifferential),
+									Dampened:   priorityIsDampened,
+									Dampener:   agentIndex,
+								})
+							}
+							gainedOrRetainedPriority[patient] = true
+						}
+					}
+				}
+			case Heal:
+				if !patientHasPriority {
+					// heal is interrupted
+					delayed = append(delayed, HealInterrupted{Healer: patientIndex, Attacker: agentIndex})
+				}
+
+			}
+			if attackGoesThrough {
+				damage := 1 + agent.Boost
+
+				patient.HP -= damage
+				patient.HP = max(patient.HP, 0)
+
+				events = append(events, AttackLanded{
+					Attacker:     agentIndex,
+					Defender:     patientIndex,
+					Damage:       damage,
+					Boost:        agent.Boost,
+					WithPriority: agentHasPriority,
+					DefenderHP:   patient.HP,
+				})
+			}
+		case Guard:
+			if patientAction != Attack {
+				// no effect
+				events = append(events, GuardWasted{Guarder: agentIndex})
+			}
+		case Heal:
+			if patientAction != Attack || agentHasPriority { // heal not interrupted
+				newHP := min(agent.HP+1+agent.Boost, rules.MaxHP)
+
+				heal := HealApplied{
+					Healer:        agentIndex,
+					ThroughAttack: patientAction == Attack && agentHasPriority,
+					Attacker:      patientIndex,
+				}
+
+				if agent.HP < newHP {
+					heal.Amount = newHP - agent.HP
+					agent.HP = newHP
+				}
+				heal.HP = agent.HP
+				heal.Overheal = agent.HP > rules.StartingHP
+
+				events = append(events, heal)
+			}
+		}
+	}
+
+	events = append(events, delayed...)
+
+	// determine end game
+	isGameOver, gameWinner := state.IsGameOver()
+
+	priorityEvents := []Event{}
+	shieldEvents := []Event{}
+
+	// End Phase
+	for i, player := range players {
+		playerAction := actions[i]
+		if playerAction != Boost {
+			if player.Boost > 0 {
+				expended := player.Boost
+				player.Boost = 0
+				if !isGameOver {
+					events = append(events, BoostExpended{Player: i, Boost: expended})
+				}
+			}
+		}
+
+		if !isGameOver && !gainedOrRetainedPriority[player] && player.Priority > 0 {
+			player.Priority--
+			priorityEvents = append(priorityEvents, PriorityFell{Player: i, Priority: player.Priority})
+		}
+
+		if !isGameOver && player.ShieldBreakCounter > 0 {
+			if !shieldJustBroke[player] {
+				player.ShieldBreakCounter--
+			}
+			if player.ShieldBreakCounter == 0 {
+				shieldEvents = append(shieldEvents, ShieldMended{Player: i, Decayed: true})
+			} else {
+				shieldEvents = append(shieldEvents, ShieldDecayed{
+					Player:   i,
+					Damage:   player.ShieldBreakCounter,
+					MendOdds: rules.MendOdds(player.ShieldBreakCounter),
+				})
+			}
+		}
+	}
+	events = append(events, priorityEvents...)
+	events = append(events, shieldEvents...)
+
+	if !isGameOver {
+		state.Round++
+		return state, events
+	}
+
+	return endGame(state, events, GameWon{Winner: gameWinner})
+}
+
+// scores the game won, then either ends the match or sets up the next game
+func endGame(state State, events []Event, won GameWon) (State, []Event) {
+	rules := state.Rules
+	players := [2]*Player{&state.Players[0], &state.Players[1]}
+
+	if won.Winner != NoWinner {
+		players[won.Winner].Wins += 1
+	}
+	wins := [2]int{players[0].Wins, players[1].Wins}
+	won.Wins = wins
+	won.Final = state.Players
+	events = append(events, won)
+
+	if isMatchOver, matchWinner := state.IsMatchOver(); isMatchOver {
+		events = append(events, MatchWon{Winner: matchWinner, Wins: wins})
+	} else {
+		state.Game++
+
+		state.Round = 1
+		for _, player := range players {
+			player.HP = rules.StartingHP
+			player.Boost = 0
+			player.Priority = 0
+			player.ShieldBreakCounter = 0
+		}
+
+		events = append(events, GameStarted{Game: state.Game})
+	}
+
+	return state, events
+}
@@ -0,0 +1,189 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRollMends(t *testing.T) {
+	tests := []struct {
+		seed   uint64
+		damage [2]int
+		want   [2]bool
+	}{
+		{seed: 1, damage: [2]int{1, 0}, want: [2]bool{true, false}},
+		{seed: 1, damage: [2]int{0, 3}, want: [2]bool{false, true}},
+		{seed: 1, damage: [2]int{2, 2}, want: [2]bool{true, false}},
+		{seed: 2, damage: [2]int{0, 3}, want: [2]bool{false, false}},
+		{seed: 2, damage: [2]int{2, 2}, want: [2]bool{false, true}},
+		{seed: 3, damage: [2]int{2, 2}, want: [2]bool{true, true}},
+		{seed: 4, damage: [2]int{1, 0}, want: [2]bool{false, false}},
+		{seed: 42, damage: [2]int{2, 2}, want: [2]bool{false, false}},
+	}
+	for _, test := range tests {
+		state := NewState(Classic)
+		for i, damage := range test.damage {
+			state.Players[i].ShieldBreakCounter = damage
+		}
+		if got := RollMends(state, NewRand(test.seed)); got != test.want {
+			t.Errorf("seed %d, damage %v: mended %v, want %v", test.seed, test.damage, got, test.want)
+		}
+	}
+}
+
+// shields that aren't broken aren't rolled for, so they don't use up the seed
+func TestRollMendsOnlyRollsForBrokenShields(t *testing.T) {
+	rng := NewRand(7)
+	if got := RollMends(NewState(Classic), rng); got != [2]bool{} {
+		t.Errorf("mended %v with no broken shields", got)
+	}
+	if rng.Uint64() != NewRand(7).Uint64() {
+		t.Error("rolled with no broken shields")
+	}
+}
+
+func TestResolveRolled(t *testing.T) {
+	player := func(hp int, boost int, priority int, damage int) Player {
+		return Player{HP: hp, Boost: boost, Priority: priority, ShieldBreakCounter: damage}
+	}
+
+	tests := []struct {
+		name       string
+		players    [2]Player
+		actions    [2]Action
+		mended     [2]bool
+		want       [2]Player
+		wantGame   int
+		wantRound  int
+		wantEvents []Event
+	}{
+		{
+			name:      "a boosted attack breaks an unboosted guard",
+			players:   [2]Player{player(3, 2, 0, 0), player(3, 0, 0, 0)},
+			actions:   [2]Action{Attack, Guard},
+			want:      [2]Player{player(3, 0, 0, 0), player(3, 0, 0, 2)},
+			wantGame:  1,
+			wantRound: 2,
+			wantEvents: []Event{
+				GuardSucceeded{Attacker: 0, Guarder: 1, AttackBoost: 2},
+				ShieldBroke{Player: 1, Damage: 2},
+				BoostExpended{Player: 0, Boost: 2},
+				ShieldDecayed{Player: 1, Damage: 2, MendOdds: 3},
+			},
+		},
+		{
+			name:      "a mended shield guards and gains priority",
+			players:   [2]Player{player(3, 0, 0, 0), player(3, 0, 0, 2)},
+			actions:   [2]Action{Attack, Guard},
+			mended:    [2]bool{false, true},
+			want:      [2]Player{player(3, 0, 0, 0), player(3, 0, 1, 0)},
+			wantGame:  1,
+			wantRound: 2,
+			wantEvents: []Event{
+				ShieldMended{Player: 1},
+				GuardSucceeded{Attacker: 0, Guarder: 1},
+				PriorityGained{Player: 1, Priority: 1},
+			},
+		},
+		{
+			name:      "a shield that stays broken lets the attack through",
+			players:   [2]Player{player(3, 0, 0, 0), player(3, 0, 0, 2)},
+			actions:   [2]Action{Attack, Guard},
+			want:      [2]Player{player(3, 0, 0, 0), player(2, 0, 0, 1)},
+			wantGame:  1,
+			wantRound: 2,
+			wantEvents: []Event{
+				ShieldStillBroken{Player: 1, Damage: 2},
+				GuardFailed{Attacker: 0, Guarder: 1},
+				AttackLanded{Attacker: 0, Defender: 1, Damage: 1, DefenderHP: 2},
+				ShieldDecayed{Player: 1, Damage: 1, MendOdds: 2},
+			},
+		},
+		{
+			name:      "mending an unbroken shield does nothing",
+			players:   [2]Player{player(3, 0, 0, 0), player(3, 0, 0, 0)},
+			actions:   [2]Action{Boost, Heal},
+			mended:    [2]bool{true, true},
+			want:      [2]Player{player(3, 1, 0, 0), player(4, 0, 0, 0)},
+			wantGame:  1,
+			wantRound: 2,
+			wantEvents: []Event{
+				BoostGained{Player: 0, Boost: 1},
+				HealApplied{Healer: 1, Amount: 1, HP: 4, Overheal: true},
+			},
+		},
+		{
+			name:      "priority wins an exchange of attacks",
+			players:   [2]Player{player(3, 0, 1, 0), player(3, 0, 0, 0)},
+			actions:   [2]Action{Attack, Attack},
+			want:      [2]Player{player(3, 0, 0, 0), player(2, 0, 0, 0)},
+			wantGame:  1,
+			wantRound: 2,
+			wantEvents: []Event{
+				AttackLanded{Attacker: 0, Defender: 1, Damage: 1, WithPriority: true, DefenderHP: 2},
+				AttackNullifiedByPriority{Attacker: 1, Defender: 0},
+				PriorityFell{Player: 0, Priority: 0},
+			},
+		},
+		{
+			name:      "a knockout ends the game",
+			players:   [2]Player{player(3, 0, 0, 0), player(1, 0, 0, 0)},
+			actions:   [2]Action{Attack, Heal},
+			want:      [2]Player{{Wins: 1, HP: 3}, {HP: 3}},
+			wantGame:  2,
+			wantRound: 1,
+			wantEvents: []Event{
+				AttackLanded{Attacker: 0, Defender: 1, Damage: 1, DefenderHP: 0},
+				HealInterrupted{Healer: 1, Attacker: 0},
+				GameWon{Winner: 0, Wins: [2]int{1, 0}, Final: [2]Player{{Wins: 1, HP: 3}, {HP: 0}}},
+				GameStarted{Game: 2},
+			},
+		},
+		{
+			name:      "forfeiting the round leaves the other's action unopposed",
+			players:   [2]Player{player(3, 0, 0, 0), player(3, 1, 0, 0)},
+			actions:   [2]Action{Unchosen, Attack},
+			want:      [2]Player{player(1, 0, 0, 0), player(3, 0, 0, 0)},
+			wantGame:  1,
+			wantRound: 2,
+			wantEvents: []Event{
+				RoundForfeited{Player: 0},
+				AttackLanded{Attacker: 1, Defender: 0, Damage: 2, Boost: 1, DefenderHP: 1},
+				BoostExpended{Player: 1, Boost: 1},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := NewState(Classic)
+			state.Players = test.players
+
+			next, events := ResolveRolled(state, test.actions, test.mended)
+			if next.Players != test.want {
+				t.Errorf("players are %+v, want %+v", next.Players, test.want)
+			}
+			if next.Game != test.wantGame || next.Round != test.wantRound {
+				t.Errorf("on game %d round %d, want game %d round %d", next.Game, next.Round, test.wantGame, test.wantRound)
+			}
+			if !reflect.DeepEqual(events, test.wantEvents) {
+				t.Errorf("events are\n%#v\nwant\n%#v", events, test.wantEvents)
+			}
+		})
+	}
+}
+
+// Resolve rolls the same way RollMends does, so a match replays from its seed
+func TestResolveMatchesRolledResolution(t *testing.T) {
+	for _, seed := range []uint64{1, 2, 3, 4, 5, 42} {
+		state := NewState(Classic)
+		state.Players[0].Boost = 3
+		state.Players[1].ShieldBreakCounter = 3
+
+		rolls := NewRand(seed)
+		want, wantEvents := ResolveRolled(state, [2]Action{Attack, Guard}, RollMends(state, rolls))
+		got, events := Resolve(state, [2]Action{Attack, Guard}, NewRand(seed))
+		if got != want || !reflect.DeepEqual(events, wantEvents) {
+			t.Errorf("seed %d: Resolve and ResolveRolled disagree", seed)
+		}
+	}
+}
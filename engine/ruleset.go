@@ -0,0 +1,198 @@
+package engine
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ruleset holds the numbers a match is played with.
+type Ruleset struct {
+	Name       string
+	StartingHP int
+	MaxBoost   int
+	// the overheal cap
+	MaxHP      int
+	GamesToWin int
+	// a shield with damage d mends with a chance of 1 in (d + MendBase)
+	MendBase int
+	Clock    RoundClock
+}
+
+// TimeoutPolicy is what happens to a player who runs out of time in a round.
+type TimeoutPolicy int
+
+const (
+	// the player guards
+	TimeoutGuard TimeoutPolicy = iota
+	// the player forfeits the round, doing nothing while the other's action plays out
+	TimeoutForfeitRound
+)
+
+// RoundClock limits how long players have to choose their actions each round.
+// The rules themselves don't keep time; front-ends that do enforce it.
+type RoundClock struct {
+	// no limit if 0
+	Limit     time.Duration
+	OnTimeout TimeoutPolicy
+	// a player who runs out of time this many times forfeits the match,
+	// or never if 0
+	MaxTimeouts int
+}
+
+func (clock RoundClock) IsSet() bool {
+	return clock.Limit > 0
+}
+
+// FormatDuration writes d like time.Duration's String, without the zero units on the end,
+// so a minute is "1m" rather than "1m0s".
+func FormatDuration(d time.Duration) string {
+	formatted := d.String()
+	if d == 0 {
+		return formatted
+	}
+	if d%time.Minute == 0 {
+		formatted = strings.TrimSuffix(formatted, "0s")
+	}
+	if d%time.Hour == 0 {
+		formatted = strings.TrimSuffix(formatted, "0m")
+	}
+	return formatted
+}
+
+// Describe summarizes the clock for players agreeing to a match.
+func (clock RoundClock) Describe() string {
+	if !clock.IsSet() {
+		return "no round clock"
+	}
+	description := FormatDuration(clock.Limit) + " per round, then "
+	switch clock.OnTimeout {
+	case TimeoutGuard:
+		description += "guard"
+	case TimeoutForfeitRound:
+		description += "forfeit the round"
+	}
+	if clock.MaxTimeouts > 0 {
+		description += ", forfeiting the match after " + strconv.Itoa(clock.MaxTimeouts) + " timeouts"
+	}
+	return description
+}
+
+var (
+	Classic = Ruleset{
+		Name:       "classic",
+		StartingHP: 3,
+		MaxBoost:   6,
+		MaxHP:      3 + 1 + 6,
+		GamesToWin: 3,
+		MendBase:   1,
+	}
+	Quick = Ruleset{
+		Name:       "quick",
+		StartingHP: 3,
+		MaxBoost:   6,
+		MaxHP:      3 + 1 + 6,
+		GamesToWin: 1,
+		MendBase:   1,
+	}
+	Long = Ruleset{
+		Name:       "long",
+		StartingHP: 3,
+		MaxBoost:   6,
+		MaxHP:      3 + 1 + 6,
+		GamesToWin: 5,
+		MendBase:   1,
+	}
+	HighHP = Ruleset{
+		Name:       "high-hp",
+		StartingHP: 6,
+		MaxBoost:   6,
+		MaxHP:      6 + 1 + 6,
+		GamesToWin: 3,
+		MendBase:   1,
+	}
+)
+
+// Presets lists the named rulesets in the order they should be offered.
+var Presets = []Ruleset{Classic, Quick, Long, HighHP}
+
+func PresetByName(name string) (Ruleset, bool) {
+	for _, preset := range Presets {
+		if preset.Name == name {
+			return preset, true
+		}
+	}
+	return Ruleset{}, false
+}
+
+func (r Ruleset) Validate() error {
+	if r.StartingHP < 1 {
+		return errors.New("starting HP must be at least 1")
+	}
+	if r.MaxBoost < 0 {
+		return errors.New("boost cap can't be negative")
+	}
+	if r.MaxHP < r.StartingHP {
+		return errors.New("overheal cap can't be lower than starting HP")
+	}
+	if r.GamesToWin < 1 {
+		return errors.New("games to win must be at least 1")
+	}
+	if r.MendBase < 1 {
+		return errors.New("shield mend base must be at least 1")
+	}
+	if r.Clock.Limit < 0 || (r.Clock.IsSet() && r.Clock.Limit < 10*time.Second) {
+		return errors.New("round clock must be at least 10 seconds, or 0 for none")
+	}
+	if r.Clock.OnTimeout != TimeoutGuard && r.Clock.OnTimeout != TimeoutForfeitRound {
+		return errors.New("unknown timeout policy")
+	}
+	if r.Clock.MaxTimeouts < 0 {
+		return errors.New("timeouts before forfeiting can't be negative")
+	}
+	return nil
+}
+
+// MendOdds is the N in the 1 in N chance that a shield with the given damage mends.
+func (r Ruleset) MendOdds(damage int) int {
+	return damage + r.MendBase
+}
+
+// Describe summarizes the ruleset for players agreeing to a match.
+func (r Ruleset) Describe() string {
+	clock := ""
+	if r.Clock.IsSet() {
+		clock = ", " + r.Clock.Describe()
+	}
+	games := "games"
+	if r.GamesToWin == 1 {
+		games = "game"
+	}
+	return "first to " + strconv.Itoa(r.GamesToWin) + " " + games +
+		", " + strconv.Itoa(r.StartingHP) + " starting HP" +
+		" (overheal up to " + strconv.Itoa(r.MaxHP) + ")" +
+		", boost cap of " + strconv.Itoa(r.MaxBoost) + clock
+}
+
+// CustomRuleset builds a ruleset from the terms players pick when making a challenge.
+// The overheal cap is derived the classic way and shields mend as in classic.
+// It takes a preset's name if it matches one.
+func CustomRuleset(gamesToWin int, startingHP int, maxBoost int) Ruleset {
+	rules := Ruleset{
+		Name:       "custom",
+		StartingHP: startingHP,
+		MaxBoost:   maxBoost,
+		MaxHP:      startingHP + 1 + maxBoost,
+		GamesToWin: gamesToWin,
+		MendBase:   Classic.MendBase,
+	}
+	for _, preset := range Presets {
+		named := rules
+		named.Name = preset.Name
+		if named == preset {
+			return preset
+		}
+	}
+	return rules
+}
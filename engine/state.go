@@ -0,0 +1,112 @@
+package engine
+
+import "strconv"
+
+// NoWinner is reported in place of a player index when a game or match is drawn.
+const NoWinner = -1
+
+type Player struct {
+	Wins               int
+	HP                 int
+	ShieldBreakCounter int
+	Priority           int
+	Boost              int
+}
+
+func NewPlayer(rules Ruleset) Player {
+	return Player{
+		HP:       rules.StartingHP,
+		Priority: 0,
+		Boost:    0,
+	}
+}
+
+// State is everything the rules need to know about a match.
+// Players[0] is the challenger and Players[1] is the challengee.
+type State struct {
+	Players [2]Player
+	Game    int
+	Round   int
+	Rules   Ruleset
+}
+
+func NewState(rules Ruleset) State {
+	return State{
+		Players: [2]Player{NewPlayer(rules), NewPlayer(rules)},
+		Game:    1,
+		Round:   1,
+		Rules:   rules,
+	}
+}
+
+// Swapped returns the state as seen from the other side of the table.
+func (s State) Swapped() State {
+	s.Players[0], s.Players[1] = s.Players[1], s.Players[0]
+	return s
+}
+
+// returns whether the game ended, and the index of the winner,
+// or NoWinner if it was a draw
+func (s State) IsGameOver() (bool, int) {
+	p0, p1 := s.Players[0], s.Players[1]
+	if p0.HP > 0 && p1.HP > 0 {
+		return false, NoWinner
+	}
+	if p0.HP > p1.HP {
+		return true, 0
+	}
+	if p1.HP > p0.HP {
+		return true, 1
+	}
+
+	// if both player have no health and both have the same HP, draw.
+	return true, NoWinner
+}
+
+func (s State) IsMatchOver() (bool, int) {
+	p0, p1 := s.Players[0], s.Players[1]
+	toWin := s.Rules.GamesToWin
+	if p0.Wins >= toWin && p1.Wins < toWin {
+		return true, 0
+	}
+	if p1.Wins >= toWin && p0.Wins < toWin {
+		return true, 1
+	}
+	if p0.Wins >= toWin && p1.Wins >= toWin {
+		return true, NoWinner
+	}
+	return false, NoWinner
+}
+
+func (s State) GameNumberString() string {
+	return "# Game " + strconv.Itoa(s.Game) + "\n"
+}
+
+// ToString renders the round in Markdown, naming each player by names[i].
+func (s State) ToString(names [2]string) string {
+	gameString := "## Round " + strconv.Itoa(s.Round) + "\n"
+	for i, player := range s.Players {
+		shield := ""
+		if player.ShieldBreakCounter > 0 {
+			shield += "- 🛡️❌ (chance of mending: 1 in " + strconv.Itoa(s.Rules.MendOdds(player.ShieldBreakCounter)) + ")\n"
+		}
+		boost := ""
+		if player.Boost > 0 {
+			boost = "- ⬆️"
+			if player.Boost > 1 {
+				boost += "x" + strconv.Itoa(player.Boost)
+			}
+			boost += "\n"
+		}
+		priority := ""
+		if player.Priority > 0 {
+			priority = "- [Priority"
+			if player.Priority > 1 {
+				priority += "x" + strconv.Itoa(player.Priority)
+			}
+			priority += "]\n"
+		}
+		gameString += "🤺 " + names[i] + "\n- ❤️x" + strconv.Itoa(player.HP) + "\n" + shield + boost + priority + "\n"
+	}
+	return gameString
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// expires the challenge once it's waited ChallengeExpiry for an answer.
+// A challenge that's answered, rescinded, or removed first is no longer held
+// by the time the timer goes off, so nothing happens to it.
+func scheduleChallengeExpiry(s *discordgo.Session, guildID string, challenge *AwaitingChallengeResponse) {
+	if ChallengeExpiry <= 0 {
+		return
+	}
+	time.AfterFunc(time.Until(challenge.Issued.Add(ChallengeExpiry)), func() {
+		expireChallenge(s, guildID, challenge)
+	})
+}
+
+func expireChallenge(s *discordgo.Session, guildID string, challenge *AwaitingChallengeResponse) {
+	challenge.Lock()
+	defer challenge.Unlock()
+
+	challenger := challenge.Challenger
+	challengee := challenge.Challengee
+	if !Games.Remove(guildID, challenge, challenger.ID, challengee.ID) {
+		return
+	}
+
+	challengerContent := challengeExpiredNotificationToChallenger(challengee)
+	challengeeContent := challengeExpiredNotificationToChallengee(challenger)
+
+	// swap the challenge's buttons for one that clears it, so it can't be answered,
+	// which is all the challengee is told
+	if challenge.ChallengeeMessage != nil {
+		s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+			ID:         challenge.ChallengeeMessage.ID,
+			Channel:    challenge.ChallengeeMessage.ChannelID,
+			Content:    &challengeeContent,
+			Components: &clearNotificationButton,
+		})
+	}
+	for _, ci := range challenge.ChallengerInteractions {
+		s.InteractionResponseEdit(ci, &discordgo.WebhookEdit{
+			Content:    &challengerContent,
+			Components: &emptyActionGrid,
+		})
+	}
+
+	challengerDMChannel, _ := s.UserChannelCreate(challenger.ID)
+	s.ChannelMessageSendComplex(challengerDMChannel.ID, &discordgo.MessageSend{
+		Content:    challengerContent,
+		Components: clearNotificationButton,
+	})
+}
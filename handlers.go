@@ -2,11 +2,18 @@ package main
 
 import (
 	"fmt"
+	"math/rand/v2"
 	"os"
 	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 	"unicode/utf8"
 
+	"hwacha/bagh/ai"
+	"hwacha/bagh/engine"
+
 	"github.com/bwmarrin/discordgo"
 )
 
@@ -24,8 +31,8 @@ var actionSelectedResponseData = func(action Action) discordgo.InteractionRespon
 	}
 }
 
-func bagherRoleInGuild(s *discordgo.Session, i *discordgo.Interaction) *discordgo.Role {
-	roles, _ := s.GuildRoles(i.GuildID)
+func bagherRoleInGuild(s *discordgo.Session, guildID string) *discordgo.Role {
+	roles, _ := s.GuildRoles(guildID)
 	roleIndex := slices.IndexFunc(roles, func(role *discordgo.Role) bool {
 		return role.Name == "bagher"
 	})
@@ -35,18 +42,18 @@ func bagherRoleInGuild(s *discordgo.Session, i *discordgo.Interaction) *discordg
 	return roles[roleIndex]
 }
 
-func userHasBAGHerRoleInGuild(s *discordgo.Session, i *discordgo.Interaction, user *discordgo.User) bool {
-	member, _ := s.GuildMember(i.GuildID, user.ID)
+func userHasBAGHerRoleInGuild(s *discordgo.Session, guildID string, user *discordgo.User) bool {
+	member, _ := s.GuildMember(guildID, user.ID)
 
-	brig := bagherRoleInGuild(s, i)
+	brig := bagherRoleInGuild(s, guildID)
 
 	return brig != nil && slices.ContainsFunc(member.Roles, func(roleID string) bool {
 		return brig.ID == roleID
 	})
 }
 
-func findBAGHChannelInGuild(s *discordgo.Session, i *discordgo.Interaction) *discordgo.Channel {
-	channels, _ := s.GuildChannels(i.GuildID)
+func findBAGHChannelInGuild(s *discordgo.Session, guildID string) *discordgo.Channel {
+	channels, _ := s.GuildChannels(guildID)
 	index := slices.IndexFunc(channels, func(ch *discordgo.Channel) bool { return ch.Name == "play-bagh" })
 	if index == -1 {
 		return nil
@@ -80,15 +87,87 @@ func cleanupButtons(s *discordgo.Session, game *MatchOngoing) {
 	}
 }
 
+// locks the presser's match if they pressed a button in its thread,
+// and tells them they can't otherwise. The caller must unlock the match.
+func lockPressersMatch(s *discordgo.Session, i *discordgo.InteractionCreate) (*MatchOngoing, bool) {
+	game, found := Games.LockMatch(i.GuildID, i.Interaction.Member.User.ID)
+	if !found {
+		rejectNonPlayer(s, i)
+		return nil, false
+	}
+	if game.Thread.ID != i.Interaction.ChannelID {
+		game.Unlock()
+		rejectNonPlayer(s, i)
+		return nil, false
+	}
+	return game, true
+}
+
+// tells someone who pressed a match's button that they're not playing in it
+func rejectNonPlayer(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	game, found := Games.LockMatchInThread(i.GuildID, i.Interaction.ChannelID)
+	if found {
+		isSpectator := game.IsSpectator(i.Interaction.Member.User.ID)
+		game.Unlock()
+		if isSpectator {
+			ir(s, i, spectatorUsesInGameCommandErrorMessage)
+			return
+		}
+	}
+	ir(s, i, nonPlayerUsesInGameCommandErrorMessage)
+}
+
+// adds the user to the match's thread to watch it, and shows them the current round.
+// The caller must hold the match's lock.
+func spectateMatch(s *discordgo.Session, i *discordgo.InteractionCreate, game *MatchOngoing) {
+	spectator := i.Interaction.Member.User
+	if game.GetPlayer(spectator.ID) != nil {
+		ir(s, i, playerInGameRedirectToGameThread(game.Thread))
+		return
+	}
+
+	if err := s.ThreadMemberAdd(game.Thread.ID, spectator.ID); err != nil {
+		ir(s, i, watchThreadMissingErrorMessage)
+		return
+	}
+	if !game.IsSpectator(spectator.ID) {
+		game.Spectators = append(game.Spectators, spectator.ID)
+		Games.Save(i.GuildID, game)
+	}
+
+	ir(s, i, spectatingConfirmation(game.Thread)+"\n"+game.ToString())
+}
+
+// shows the presser the actions they can choose from, or the one they chose.
+// The caller must hold the match's lock.
+func respondWithActionOptions(s *discordgo.Session, i *discordgo.InteractionCreate, game *MatchOngoing) {
+	player := game.GetPlayer(i.Interaction.Member.User.ID)
+
+	player.Interactions.ChooseAction = append(player.Interactions.ChooseAction, i.Interaction)
+
+	var responseData discordgo.InteractionResponseData
+
+	if player.GetAction() == Unchosen {
+		responseData = actionOptionsResponseData
+	} else {
+		responseData = actionSelectedResponseData(player.GetAction())
+	}
+
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &responseData,
+	})
+}
+
 func handleGameActionSelection(action Action) func(*discordgo.Session, *discordgo.InteractionCreate) {
 	return func(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		presserID := i.Interaction.Member.User.ID
-		game, found := Games[presserID].(*MatchOngoing)
-
-		if !(found && game.Thread.ID == i.Interaction.ChannelID) {
-			ir(s, i, nonPlayerUsesInGameCommandErrorMessage)
+		game, found := lockPressersMatch(s, i)
+		if !found {
 			return
 		}
+		defer game.Unlock()
+		defer Games.Save(i.GuildID, game)
 
 		actor := game.GetPlayer(presserID)
 
@@ -111,8 +190,6 @@ func handleGameActionSelection(action Action) func(*discordgo.Session, *discordg
 			}
 			return
 		} else {
-			actor.SetAction(action)
-
 			asrd := actionSelectedResponseData(action)
 
 			s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
@@ -131,45 +208,189 @@ func handleGameActionSelection(action Action) func(*discordgo.Session, *discordg
 			actor.Interactions.ChooseAction = append(actor.Interactions.ChooseAction, i.Interaction)
 		}
 
-		if game.Challenger.GetAction() != Unchosen && game.Challengee.GetAction() != Unchosen && !actor.actionLocked {
+		if played, actionLog, isMatchOver, winner := game.Choose(presserID, action); played {
+			cleanupButtons(s, game)
+			finishRound(s, i.GuildID, game, actionLog, isMatchOver, winner)
+		}
+	}
+}
+
+// ends the match with the player forfeiting it. The caller must hold the match's lock.
+func forfeitMatch(s *discordgo.Session, guildID string, game *MatchOngoing, forfeiterID string) {
+	stopRoundClock(game)
+	cleanupButtons(s, game)
 
-			for _, player := range game.GetPlayers() {
-				player.actionLocked = true
-			}
+	forfeiter := game.GetPlayer(forfeiterID).User
+	winner := game.GetOtherPlayer(forfeiterID).User
 
-			cleanupButtons(s, game)
+	// remove game session
+	var archived *ArchivedMatch
+	if Games.Remove(guildID, game, forfeiter.ID, winner.ID) {
+		archived = archiveMatch(guildID, game, OutcomeForfeit, game.playerIndex(winner.ID))
+		finishScoreboard(s, game, OutcomeForfeit, game.playerIndex(winner.ID))
+	}
 
-			actionLog, isMatchOver, winner := game.NextStateFromActions()
-			s.ChannelMessageSend(game.Thread.ID, actionLog)
+	// notify thread of forfeit and winner
+	s.ChannelMessageSend(game.Thread.ID, forfeitNotification(forfeiter, winner))
+	postRecap(s, game, archived)
+}
 
-			for _, player := range game.GetPlayers() {
-				player.ClearAction()
-				player.UnlockAction()
-			}
+// stops both players from changing their actions while the round is played.
+// The caller must hold the match's lock.
+func lockActionsForRound(s *discordgo.Session, game *MatchOngoing) {
+	for _, player := range game.GetPlayers() {
+		player.actionLocked = true
+	}
 
-			if isMatchOver {
-				delete(Games, game.Challenger.User.ID)
-				delete(Games, game.Challengee.User.ID)
+	cleanupButtons(s, game)
+}
 
-				if winner == nil {
-					s.ChannelMessageSend(game.Thread.ID, "# Draw.")
-				} else {
-					s.ChannelMessageSend(game.Thread.ID, "# Congratulations, "+winner.User.Mention()+"!")
-				}
-			} else {
-				msg, _ := s.ChannelMessageSendComplex(game.Thread.ID, &discordgo.MessageSend{
-					Content:    game.ToString(),
-					Components: chooseActionOrExitGameButtonRow,
-				})
+// posts a played round's action log, then either ends the match or sends
+// the next round. The caller must hold the match's lock.
+func finishRound(s *discordgo.Session, guildID string, game *MatchOngoing, actionLog string, isMatchOver bool, winner *Player) {
+	stopRoundClock(game)
+	s.ChannelMessageSend(game.Thread.ID, actionLog)
+
+	if isMatchOver {
+		outcome, winnerIndex := OutcomeDraw, engine.NoWinner
+		if winner != nil {
+			outcome, winnerIndex = OutcomeWin, game.playerIndex(winner.User.ID)
+		}
+		var archived *ArchivedMatch
+		if Games.Remove(guildID, game, game.Challenger.User.ID, game.Challengee.User.ID) {
+			archived = archiveMatch(guildID, game, outcome, winnerIndex)
+			finishScoreboard(s, game, outcome, winnerIndex)
+		}
 
-				game.LastRoundMessageID = msg.ID
+		result := "# Draw."
+		if winner != nil {
+			result = "# Congratulations, " + winner.User.Mention() + "!"
+		}
+		s.ChannelMessageSendComplex(game.Thread.ID, &discordgo.MessageSend{
+			Content: result,
+			Files:   roundImageFiles(game.State),
+		})
+		postRecap(s, game, archived)
+	} else {
+		msg, _ := sendRoundMessage(s, game.Thread.ID, game, "")
 
-				if game.Challengee.User.ID == ApplicationID {
-					game.ChooseAIMove()
-				}
+		game.LastRoundMessageID = msg.ID
+		updateScoreboard(s, game)
+
+		if game.Challengee.User.ID == ApplicationID {
+			game.ChooseAIMove()
+		}
+
+		startRoundClock(s, guildID, game)
+	}
+}
+
+// starts the thread a new match is played in, and sends it the first round.
+// The caller must hold the match's lock.
+func startMatchThread(s *discordgo.Session, ch *discordgo.Channel, title string, game *MatchOngoing) *discordgo.Channel {
+	thread, _ := s.ThreadStart(ch.ID, title, discordgo.ChannelTypeGuildPrivateThread, 60)
+
+	// put the thread reference in the game object
+	Games.SetThread(game, thread)
+
+	msg, _ := sendRoundMessage(s, thread.ID, game, game.GameNumberString())
+
+	game.LastRoundMessageID = msg.ID
+
+	// let everyone else in play-bagh follow along
+	postScoreboard(s, ch, game)
+
+	startRoundClock(s, ch.GuildID, game)
+	return thread
+}
+
+// starts a ranked match between two players the queue paired,
+// the same way as when a challenge is accepted
+func startQueuedMatch(s *discordgo.Session, pair QueuePair) {
+	players := pair.Players
+	playBAGHChannel := findBAGHChannelInGuild(s, pair.GuildID)
+	if playBAGHChannel == nil {
+		for _, player := range players {
+			content := playBAGHChannelMissingErrorMessage
+			s.InteractionResponseEdit(player.Interaction, &discordgo.WebhookEdit{
+				Content:    &content,
+				Components: &emptyActionGrid,
+			})
+		}
+		return
+	}
+
+	newGame := NewMatchOngoing(nil, players[0].User, players[1].User, queuedMatchRules, rand.Uint64())
+
+	// hold the match until its thread is ready
+	newGame.Lock()
+	defer newGame.Unlock()
+	defer Games.Save(pair.GuildID, newGame)
+
+	if !Games.Claim(pair.GuildID, newGame, players[0].User.ID, players[1].User.ID) {
+		// one of them got busy since being paired, so put whoever's free back in line
+		for _, player := range players {
+			if !Games.Has(pair.GuildID, player.User.ID) {
+				Queue.Join(pair.GuildID, player)
 			}
 		}
+		return
+	}
+
+	challengerMember, _ := s.GuildMember(pair.GuildID, players[0].User.ID)
+	challengeeMember, _ := s.GuildMember(pair.GuildID, players[1].User.ID)
+	thread := startMatchThread(s, playBAGHChannel, gameThreadTitle(challengerMember, challengeeMember), newGame)
+
+	for i, player := range players {
+		content := queuedMatchFoundNotification(players[1-i].User, thread)
+		s.InteractionResponseEdit(player.Interaction, &discordgo.WebhookEdit{
+			Content:    &content,
+			Components: &emptyActionGrid,
+		})
+	}
+}
+
+// pairs up queued players every so often, for as long as the bot runs
+func runMatchmaking(s *discordgo.Session) {
+	ticker := time.NewTicker(matchmakingInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		for _, pair := range Queue.Pair(now, Games.Has) {
+			startQueuedMatch(s, pair)
+		}
+	}
+}
+
+// starts a new thread for a match whose thread is gone, and sends it the current round,
+// reporting whether it had to. The caller must hold the match's lock.
+func restoreMatchThread(s *discordgo.Session, guildID string, ch *discordgo.Channel, game *MatchOngoing) bool {
+	threadToConfirm, _ := s.Channel(game.Thread.ID)
+
+	if threadToConfirm != nil {
+		Games.SetThread(game, threadToConfirm)
+		return false
+	}
+
+	challengerMember, _ := s.GuildMember(guildID, game.Challenger.User.ID)
+	title := botGameThreadTitle(challengerMember, game.AILevel)
+	if !game.IsAgainstBAGH() {
+		challengeeMember, _ := s.GuildMember(guildID, game.Challengee.User.ID)
+		title = gameThreadTitle(challengerMember, challengeeMember)
 	}
+
+	newThread, _ := s.ThreadStart(ch.ID, title,
+		discordgo.ChannelTypeGuildPrivateThread, 60)
+
+	Games.SetThread(game, newThread)
+	msg, _ := sendRoundMessage(s, newThread.ID, game, "")
+
+	game.LastRoundMessageID = msg.ID
+
+	// the players are added by being mentioned, but spectators aren't
+	for _, spectatorID := range game.Spectators {
+		s.ThreadMemberAdd(newThread.ID, spectatorID)
+	}
+	return true
 }
 
 func ir(s *discordgo.Session, i *discordgo.InteractionCreate, content string) {
@@ -182,6 +403,180 @@ func ir(s *discordgo.Session, i *discordgo.InteractionCreate, content string) {
 	})
 }
 
+func irUpdate(s *discordgo.Session, i *discordgo.InteractionCreate, content string) {
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    content,
+			Flags:      discordgo.MessageFlagsEphemeral,
+			Components: emptyActionGrid,
+		},
+	})
+}
+
+// responds with the page of the guild's leaderboard, either as a new message or
+// by updating the one whose button was pressed
+func respondWithLeaderboardPage(s *discordgo.Session, i *discordgo.InteractionCreate, page int, responseType discordgo.InteractionResponseType) {
+	if Ratings == nil {
+		ir(s, i, leaderboardUnavailableErrorMessage)
+		return
+	}
+
+	standings, err := Ratings.Leaderboard(i.GuildID)
+	if err != nil {
+		fmt.Println("error reading ratings: ", err)
+	}
+
+	pages := max(1, (len(standings)+leaderboardPageSize-1)/leaderboardPageSize)
+	page = min(max(page, 0), pages-1)
+
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: responseType,
+		Data: &discordgo.InteractionResponseData{
+			Content:         leaderboardMessage(standings, page, pages),
+			Flags:           discordgo.MessageFlagsEphemeral,
+			Components:      leaderboardPageButtonRow(page, pages),
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		},
+	})
+}
+
+func respondWithReplayStep(s *discordgo.Session, i *discordgo.InteractionCreate, matchID string, step int, responseType discordgo.InteractionResponseType) {
+	if History == nil {
+		ir(s, i, replayUnavailableErrorMessage)
+		return
+	}
+
+	match, err := History.Get(matchID)
+	if err != nil || match.GuildID != i.GuildID {
+		ir(s, i, replayNotFoundErrorMessage(matchID))
+		return
+	}
+
+	steps, err := replaySteps(match)
+	if err != nil {
+		fmt.Println("error replaying match: ", err)
+		ir(s, i, replayNotFoundErrorMessage(matchID))
+		return
+	}
+	step = min(max(step, 0), len(steps)-1)
+
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: responseType,
+		Data: &discordgo.InteractionResponseData{
+			Content:         replayStepMessage(match, steps[step], step, len(steps)),
+			Flags:           discordgo.MessageFlagsEphemeral,
+			Components:      replayStepButtonRow(match.ID, step, len(steps)),
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		},
+	})
+}
+
+func handleChallengeTermsSelection(applyTerm func(draft *ChallengeDraft, value int)) func(*discordgo.Session, *discordgo.InteractionCreate) {
+	return func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		value := -1
+		values := i.MessageComponentData().Values
+		if len(values) > 0 {
+			if parsed, err := strconv.Atoi(values[0]); err == nil {
+				value = parsed
+			}
+		}
+
+		draft, found := Games.UpdateDraft(i.GuildID, i.Interaction.Member.User.ID, func(draft *ChallengeDraft) {
+			if value != -1 {
+				applyTerm(draft, value)
+			}
+		})
+		if !found {
+			irUpdate(s, i, challengeDraftOutdatedErrorMessage)
+			return
+		}
+
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseUpdateMessage,
+			Data: &discordgo.InteractionResponseData{
+				Content:    challengeTermsPrompt(&draft),
+				Flags:      discordgo.MessageFlagsEphemeral,
+				Components: challengeTermsComponents(&draft),
+			},
+		})
+	}
+}
+
+// sends the challenger's drafted challenge, or starts the match
+// right away if BAGH was challenged
+func sendChallenge(s *discordgo.Session, i *discordgo.InteractionCreate, challenger *discordgo.User, draft *ChallengeDraft) {
+	challengee := draft.Challengee
+
+	// challenge BAGH
+	if challengee.ID == ApplicationID {
+		newGame := NewMatchOngoing(nil, challenger, challengee, draft.Rules, rand.Uint64())
+		newGame.AILevel = draft.AILevel
+
+		// hold the match until its thread is ready
+		newGame.Lock()
+		defer newGame.Unlock()
+		defer Games.Save(i.GuildID, newGame)
+
+		if !Games.Claim(i.GuildID, newGame, challenger.ID) {
+			irUpdate(s, i, challengerIssuesChallengeWhileInSessionErrorMessage)
+			return
+		}
+
+		// start a new thread for a game
+		challengerMember, _ := s.GuildMember(i.GuildID, challenger.ID)
+		newGame.ChooseAIMove()
+		thread := startMatchThread(s, draft.Channel, botGameThreadTitle(challengerMember, draft.AILevel), newGame)
+
+		irUpdate(s, i, challengeAcceptNotificationForChallenger(challengee, thread))
+		return
+	}
+
+	newGameSession := &AwaitingChallengeResponse{
+		Challenger:             challenger,
+		Challengee:             challengee,
+		Channel:                draft.Channel,
+		Rules:                  draft.Rules,
+		ChallengerInteractions: []*discordgo.Interaction{i.Interaction},
+		Issued:                 time.Now(),
+	}
+
+	// hold the challenge until the challengee has been sent it
+	newGameSession.Lock()
+	defer newGameSession.Unlock()
+	defer Games.Save(i.GuildID, newGameSession)
+
+	if Games.Has(i.GuildID, challenger.ID) {
+		irUpdate(s, i, challengerIssuesChallengeWhileInSessionErrorMessage)
+		return
+	}
+
+	if !Games.Claim(i.GuildID, newGameSession, challenger.ID, challengee.ID) {
+		irUpdate(s, i, challengeIssuedWhileChallengeeInSessionErrorMessage(challengee))
+		return
+	}
+
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    challengeIssuedConfirmationToChallenger(challengee),
+			Flags:      discordgo.MessageFlagsEphemeral,
+			Components: rescindButton,
+		},
+	})
+
+	guild, _ := s.Guild(i.GuildID)
+	challengeeDM, _ := s.UserChannelCreate(challengee.ID)
+	challengeeMessage, _ := s.ChannelMessageSendComplex(challengeeDM.ID, &discordgo.MessageSend{
+		Content:    challengeIssuedNotificationToChallengee(challenger, guild, draft.Rules),
+		Flags:      discordgo.MessageFlagsEphemeral,
+		Components: acceptOrRefuseButtonRow,
+	})
+
+	newGameSession.ChallengeeMessage = challengeeMessage
+	scheduleChallengeExpiry(s, i.GuildID, newGameSession)
+}
+
 func makeChannelAndRoleForGuild(s *discordgo.Session, guild *discordgo.Guild) (*discordgo.Channel, error, bool) {
 	// create a text channel for bagh, if it doesn't exist
 	channels, _ := s.GuildChannels(guild.ID)
@@ -235,9 +630,10 @@ func makeChannelAndRoleForGuild(s *discordgo.Session, guild *discordgo.Guild) (*
 					Allow: discordgo.PermissionViewChannel,
 				},
 				{
-					ID:    ApplicationID,
-					Type:  discordgo.PermissionOverwriteTypeMember,
-					Allow: discordgo.PermissionViewChannel,
+					ID:   ApplicationID,
+					Type: discordgo.PermissionOverwriteTypeMember,
+					// managing messages lets BAGH keep spectators quiet in match threads
+					Allow: discordgo.PermissionViewChannel | discordgo.PermissionManageMessages,
 				},
 			},
 		})
@@ -255,9 +651,10 @@ func makeChannelAndRoleForGuild(s *discordgo.Session, guild *discordgo.Guild) (*
 					Allow: discordgo.PermissionViewChannel,
 				},
 				{
-					ID:    ApplicationID,
-					Type:  discordgo.PermissionOverwriteTypeMember,
-					Allow: discordgo.PermissionViewChannel,
+					ID:   ApplicationID,
+					Type: discordgo.PermissionOverwriteTypeMember,
+					// managing messages lets BAGH keep spectators quiet in match threads
+					Allow: discordgo.PermissionViewChannel | discordgo.PermissionManageMessages,
 				},
 			},
 		})
@@ -329,24 +726,25 @@ var applicationCommandsAndHandlers = func() map[string]ApplicationCommandAndHand
 			},
 			Handler: func(s *discordgo.Session, i *discordgo.InteractionCreate) {
 				// case 0: bagher role is missing.
-				if bagherRoleInGuild(s, i.Interaction) == nil {
+				if bagherRoleInGuild(s, i.GuildID) == nil {
 					ir(s, i, roleMissingErrorMessage)
 					return
 				}
 
 				// case 1: member is not a BAGHer.
-				if !userHasBAGHerRoleInGuild(s, i.Interaction, i.Interaction.Member.User) {
+				if !userHasBAGHerRoleInGuild(s, i.GuildID, i.Interaction.Member.User) {
 					ir(s, i, challengerNotBAGHerErrorMessage)
 					return
 				}
 
-				session, memberHasSession := Games[i.Interaction.Member.User.ID]
+				session, memberHasSession := Games.Lock(i.GuildID, i.Interaction.Member.User.ID)
 
 				// case 2: member is not in a session
 				if !memberHasSession {
 					ir(s, i, issueChallengePrompt)
 					return
 				}
+				defer session.Unlock()
 
 				challenge, sessionIsChallenge := session.(*AwaitingChallengeResponse)
 				if sessionIsChallenge {
@@ -375,14 +773,11 @@ var applicationCommandsAndHandlers = func() map[string]ApplicationCommandAndHand
 					if i.Interaction.ChannelID == game.Thread.ID {
 						// case 5: member is in-game, in the thread, but the message has been deleted.
 						if !slices.ContainsFunc(game.Thread.Messages, func(m *discordgo.Message) bool { return m.ID == game.LastRoundMessageID }) {
-							s.ChannelMessageSendComplex(game.Thread.ID, &discordgo.MessageSend{
-								Content:    game.ToString(),
-								Components: chooseActionOrExitGameButtonRow,
-							})
+							sendRoundMessage(s, game.Thread.ID, game, "")
 							ir(s, i, resendLastRoundNotification)
 						} else {
 							// case 6: member is in-game, in the thread.
-							messageComponentHandlers["choose_action"](s, i)
+							respondWithActionOptions(s, i, game)
 						}
 					} else {
 						threadToConfirm, _ := s.Channel(game.Thread.ID)
@@ -403,10 +798,10 @@ var applicationCommandsAndHandlers = func() map[string]ApplicationCommandAndHand
 				Description: "adds bagher role",
 			},
 			Handler: func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-				brig := bagherRoleInGuild(s, i.Interaction)
+				brig := bagherRoleInGuild(s, i.GuildID)
 				if brig == nil {
 					ir(s, i, roleMissingErrorMessage)
-				} else if userHasBAGHerRoleInGuild(s, i.Interaction, i.Member.User) {
+				} else if userHasBAGHerRoleInGuild(s, i.GuildID, i.Member.User) {
 					ir(s, i, alreadyBAGHerErrorMessage)
 				} else {
 					s.GuildMemberRoleAdd(i.GuildID, i.Member.User.ID, brig.ID)
@@ -421,17 +816,16 @@ var applicationCommandsAndHandlers = func() map[string]ApplicationCommandAndHand
 				Description: "removes bagher role",
 			},
 			Handler: func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-				_, inSession := Games[i.Interaction.Member.User.ID]
-
-				if inSession {
+				if Games.Has(i.GuildID, i.Interaction.Member.User.ID) {
 					ir(s, i, leaveWhenInSessionErrorMessage)
 					return
 				}
+				Queue.Leave(i.GuildID, i.Interaction.Member.User.ID)
 
-				brig := bagherRoleInGuild(s, i.Interaction)
+				brig := bagherRoleInGuild(s, i.GuildID)
 				if brig == nil {
 					ir(s, i, roleMissingErrorMessage)
-				} else if !userHasBAGHerRoleInGuild(s, i.Interaction, i.Member.User) {
+				} else if !userHasBAGHerRoleInGuild(s, i.GuildID, i.Member.User) {
 					ir(s, i, alreadyNotBAGHerErrorMessage)
 				} else {
 					s.GuildMemberRoleRemove(i.GuildID, i.Member.User.ID, brig.ID)
@@ -455,50 +849,247 @@ var applicationCommandsAndHandlers = func() map[string]ApplicationCommandAndHand
 					return
 				}
 
-				for _, session := range Games {
+				for _, session := range Games.InGuild(guild.ID) {
+					session.Lock()
 					challenge, isChallenge := session.(*AwaitingChallengeResponse)
 					if isChallenge {
 						challenge.Channel = ch
 					} else {
 						game, _ := session.(*MatchOngoing)
+						restoreMatchThread(s, guild.ID, ch, game)
+					}
+					Games.Save(guild.ID, session)
+					session.Unlock()
+				}
+				ir(s, i, restoreConfirmation)
+			},
+		},
+		{
+			Command: discordgo.ApplicationCommand{
+				Type:        discordgo.ChatApplicationCommand,
+				Name:        "rules",
+				Description: "enumerates the rules of BAGH",
+			},
+			Handler: func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+				sendRules(s, i.Interaction)
+			},
+		},
+		{
+			Command: discordgo.ApplicationCommand{
+				Type:        discordgo.ChatApplicationCommand,
+				Name:        "stats",
+				Description: "shows a player's record in this server",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionUser,
+						Name:        "user",
+						Description: "whose stats to show (yours if left out)",
+						Required:    false,
+					},
+				},
+			},
+			Handler: func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+				if History == nil {
+					ir(s, i, statsUnavailableErrorMessage)
+					return
+				}
 
-						threadToConfirm, _ := s.Channel(game.Thread.ID)
+				user := i.Member.User
+				for _, option := range i.ApplicationCommandData().Options {
+					if option.Name == "user" {
+						user = option.UserValue(s)
+					}
+				}
 
-						if threadToConfirm != nil {
-							continue
-						}
+				matches, err := History.Matches(func(match *ArchivedMatch) bool {
+					return match.GuildID == i.GuildID && (match.Players[0].ID == user.ID || match.Players[1].ID == user.ID)
+				})
+				if err != nil {
+					fmt.Println("error reading match history: ", err)
+				}
 
-						challengerMember, _ := s.GuildMember(guild.ID, game.Challenger.User.ID)
-						var challengeeMember *discordgo.Member = nil
-						if game.Challengee.User.ID != ApplicationID {
-							challengeeMember, _ = s.GuildMember(guild.ID, game.Challengee.User.ID)
-						}
+				ir(s, i, playerStatsMessage(user, computePlayerStats(matches, user.ID)))
+			},
+		},
+		{
+			Command: discordgo.ApplicationCommand{
+				Type:        discordgo.ChatApplicationCommand,
+				Name:        "queue",
+				Description: "waits for a ranked match against someone close to your rating",
+			},
+			Handler: func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+				user := i.Interaction.Member.User
+
+				if bagherRoleInGuild(s, i.GuildID) == nil {
+					ir(s, i, roleMissingErrorMessage)
+					return
+				}
 
-						newThread, _ := s.ThreadStart(ch.ID,
-							gameThreadTitle(challengerMember, challengeeMember),
-							discordgo.ChannelTypeGuildPrivateThread, 60)
+				if !userHasBAGHerRoleInGuild(s, i.GuildID, user) {
+					ir(s, i, challengerNotBAGHerErrorMessage)
+					return
+				}
 
-						game.Thread = newThread
-						msg, _ := s.ChannelMessageSendComplex(newThread.ID, &discordgo.MessageSend{
-							Content:    game.ToString(),
-							Components: chooseActionOrExitGameButtonRow,
-						})
+				if findBAGHChannelInGuild(s, i.GuildID) == nil {
+					ir(s, i, playBAGHChannelMissingErrorMessage)
+					return
+				}
 
-						game.LastRoundMessageID = msg.ID
+				if Games.Has(i.GuildID, user.ID) {
+					ir(s, i, challengerIssuesChallengeWhileInSessionErrorMessage)
+					return
+				}
+
+				// without ratings, everyone is paired as equals
+				entry := &QueueEntry{
+					User:        user,
+					Joined:      time.Now(),
+					Interaction: i.Interaction,
+				}
+				if Ratings != nil {
+					r, err := Ratings.Get(i.GuildID, user.ID)
+					if err != nil {
+						fmt.Println("error reading ratings: ", err)
 					}
+					entry.Rating = r.Value
+				}
 
+				if !Queue.Join(i.GuildID, entry) {
+					ir(s, i, alreadyQueuedErrorMessage)
+					return
 				}
-				ir(s, i, restoreConfirmation)
+
+				s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+					Type: discordgo.InteractionResponseChannelMessageWithSource,
+					Data: &discordgo.InteractionResponseData{
+						Content:    queueJoinedConfirmation,
+						Flags:      discordgo.MessageFlagsEphemeral,
+						Components: leaveQueueButton,
+					},
+				})
 			},
 		},
 		{
 			Command: discordgo.ApplicationCommand{
 				Type:        discordgo.ChatApplicationCommand,
-				Name:        "rules",
-				Description: "enumerates the rules of BAGH",
+				Name:        "spectate",
+				Description: "watches a player's match",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionUser,
+						Name:        "user",
+						Description: "whose match to watch",
+						Required:    true,
+					},
+				},
 			},
 			Handler: func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-				sendRules(s, i.Interaction)
+				if bagherRoleInGuild(s, i.GuildID) == nil {
+					ir(s, i, roleMissingErrorMessage)
+					return
+				}
+
+				if !userHasBAGHerRoleInGuild(s, i.GuildID, i.Interaction.Member.User) {
+					ir(s, i, spectatorNotBAGHerErrorMessage)
+					return
+				}
+
+				var player *discordgo.User
+				for _, option := range i.ApplicationCommandData().Options {
+					if option.Name == "user" {
+						player = option.UserValue(s)
+					}
+				}
+
+				game, found := Games.LockMatch(i.GuildID, player.ID)
+				if !found {
+					ir(s, i, playerNotInMatchErrorMessage(player))
+					return
+				}
+				defer game.Unlock()
+
+				spectateMatch(s, i, game)
+			},
+		},
+		{
+			Command: discordgo.ApplicationCommand{
+				Type:        discordgo.ChatApplicationCommand,
+				Name:        "replay",
+				Description: "steps through a finished match",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "match-id",
+						Description: "the match's ID, from its recap or the history",
+						Required:    true,
+					},
+				},
+			},
+			Handler: func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+				matchID := ""
+				for _, option := range i.ApplicationCommandData().Options {
+					if option.Name == "match-id" {
+						matchID = option.StringValue()
+					}
+				}
+				respondWithReplayStep(s, i, matchID, 0, discordgo.InteractionResponseChannelMessageWithSource)
+			},
+		},
+		{
+			Command: discordgo.ApplicationCommand{
+				Type:        discordgo.ChatApplicationCommand,
+				Name:        "export",
+				Description: "writes a finished match down in BAGH notation",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "match-id",
+						Description: "the match's ID, from its recap or the history",
+						Required:    true,
+					},
+				},
+			},
+			Handler: func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+				if History == nil {
+					ir(s, i, replayUnavailableErrorMessage)
+					return
+				}
+
+				matchID := ""
+				for _, option := range i.ApplicationCommandData().Options {
+					if option.Name == "match-id" {
+						matchID = option.StringValue()
+					}
+				}
+
+				match, err := History.Get(matchID)
+				if err != nil || match.GuildID != i.GuildID {
+					ir(s, i, replayNotFoundErrorMessage(matchID))
+					return
+				}
+
+				s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+					Type: discordgo.InteractionResponseChannelMessageWithSource,
+					Data: &discordgo.InteractionResponseData{
+						Content: matchExportedConfirmation(match.ID),
+						Flags:   discordgo.MessageFlagsEphemeral,
+						Files: []*discordgo.File{{
+							Name:        match.ID + notationFileExtension,
+							ContentType: "text/plain",
+							Reader:      strings.NewReader(matchNotation(match).String()),
+						}},
+					},
+				})
+			},
+		},
+		{
+			Command: discordgo.ApplicationCommand{
+				Type:        discordgo.ChatApplicationCommand,
+				Name:        "leaderboard",
+				Description: "ranks this server's players by rating",
+			},
+			Handler: func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+				respondWithLeaderboardPage(s, i, 0, discordgo.InteractionResponseChannelMessageWithSource)
 			},
 		},
 		{
@@ -511,12 +1102,12 @@ var applicationCommandsAndHandlers = func() map[string]ApplicationCommandAndHand
 				challenger := user
 				challengee, _ := s.User(i.ApplicationCommandData().TargetID)
 
-				if !userHasBAGHerRoleInGuild(s, i.Interaction, challenger) {
+				if !userHasBAGHerRoleInGuild(s, i.GuildID, challenger) {
 					ir(s, i, challengerNotBAGHerErrorMessage)
 					return
 				}
 
-				if !userHasBAGHerRoleInGuild(s, i.Interaction, challengee) {
+				if !userHasBAGHerRoleInGuild(s, i.GuildID, challengee) {
 					ir(s, i, challengeeNotBAGHerError(challengee))
 					return
 				}
@@ -526,94 +1117,39 @@ var applicationCommandsAndHandlers = func() map[string]ApplicationCommandAndHand
 					return
 				}
 
-				_, hasChallenger := Games[challenger.ID]
-
-				if hasChallenger {
+				if Games.Has(i.GuildID, challenger.ID) {
 					ir(s, i, challengerIssuesChallengeWhileInSessionErrorMessage)
 					return
 				}
 
-				playBAGHChannel := findBAGHChannelInGuild(s, i.Interaction)
+				playBAGHChannel := findBAGHChannelInGuild(s, i.GuildID)
 
 				if playBAGHChannel == nil {
 					ir(s, i, playBAGHChannelMissingErrorMessage)
 					return
 				}
 
-				// challenge BAGH
-				if challengee.ID == ApplicationID {
-					// start a new thread for a game
-					playBAGHChannel := findBAGHChannelInGuild(s, i.Interaction)
-					if playBAGHChannel == nil {
-						ir(s, i, playBAGHChannelMissingErrorMessage)
-						return
-					}
-
-					challengerMember, _ := s.GuildMember(i.GuildID, challenger.ID)
-					thread, _ := s.ThreadStart(playBAGHChannel.ID, gameThreadTitle(challengerMember, nil),
-						discordgo.ChannelTypeGuildPrivateThread, 60)
-
-					newGame := MatchOngoing{
-						Thread:             thread,
-						LastRoundMessageID: "",
-						Challenger:         NewPlayer(challenger),
-						Challengee:         NewPlayer(challengee),
-						Game:               1,
-						Round:              1,
-					}
-					newGame.ChooseAIMove()
-
-					msg, _ := s.ChannelMessageSendComplex(thread.ID, &discordgo.MessageSend{
-						Content:    newGame.GameNumberString() + newGame.ToString(),
-						Components: chooseActionOrExitGameButtonRow,
-					})
-
-					newGame.LastRoundMessageID = msg.ID
-
-					Games[challenger.ID] = &newGame
-
-					s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-						Type: discordgo.InteractionResponseChannelMessageWithSource,
-						Data: &discordgo.InteractionResponseData{
-							Content: challengeAcceptNotificationForChallenger(challengee, thread),
-							Flags:   discordgo.MessageFlagsEphemeral,
-						},
-					})
+				if challengee.ID != ApplicationID && Games.Has(i.GuildID, challengee.ID) {
+					ir(s, i, challengeIssuedWhileChallengeeInSessionErrorMessage(challengee))
 					return
 				}
 
-				_, hasChallengee := Games[challengee.ID]
-				if hasChallengee {
-					ir(s, i, challengeIssuedWhileChallengeeInSessionErrorMessage(challengee))
-					return
+				draft := &ChallengeDraft{
+					Challengee: challengee,
+					Channel:    playBAGHChannel,
+					Rules:      engine.Classic,
+					AILevel:    ai.Equilibrium,
 				}
+				Games.SetDraft(i.GuildID, challenger.ID, draft)
 
 				s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 					Type: discordgo.InteractionResponseChannelMessageWithSource,
 					Data: &discordgo.InteractionResponseData{
-						Content:    challengeIssuedConfirmationToChallenger(challengee),
+						Content:    challengeTermsPrompt(draft),
 						Flags:      discordgo.MessageFlagsEphemeral,
-						Components: rescindButton,
+						Components: challengeTermsComponents(draft),
 					},
 				})
-
-				challengeeDM, _ := s.UserChannelCreate(challengee.ID)
-				challengeeMessage, _ := s.ChannelMessageSendComplex(challengeeDM.ID, &discordgo.MessageSend{
-					Content:    challengeIssuedNotificationToChallengee(challenger),
-					Flags:      discordgo.MessageFlagsEphemeral,
-					Components: acceptOrRefuseButtonRow,
-				})
-
-				newGameSession := AwaitingChallengeResponse{
-					Challenger:             challenger,
-					Challengee:             challengee,
-					Channel:                playBAGHChannel,
-					ChallengerInteractions: []*discordgo.Interaction{i.Interaction},
-					ChallengeeMessage:      challengeeMessage,
-				}
-
-				Games[challenger.ID] = &newGameSession
-				Games[challengee.ID] = &newGameSession
 			},
 		},
 	}
@@ -634,71 +1170,49 @@ var messageComponentHandlers = map[string]func(*discordgo.Session, *discordgo.In
 	"action_undo":   handleGameActionSelection(Unchosen),
 	"challenge_accept": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		acceptor := i.Interaction.User
-		challenge, hasAcceptor := Games[acceptor.ID]
+		challengeAsChallenge, isChallenge := Games.LockChallengeByMessage(acceptor.ID, i.Interaction.Message.ID)
 
-		if !hasAcceptor {
-			ir(s, i, acceptOutdatedChallengeErrorMessage)
-			s.ChannelMessageDelete(i.Interaction.ChannelID, i.Interaction.Message.ID)
-			return
-		}
-
-		challengeAsChallenge, isChallenge := challenge.(*AwaitingChallengeResponse)
 		if !isChallenge {
 			ir(s, i, acceptOutdatedChallengeErrorMessage)
 			s.ChannelMessageDelete(i.Interaction.ChannelID, i.Interaction.Message.ID)
 			return
 		}
-
-		if challengeAsChallenge.ChallengeeMessage.ID != i.Interaction.Message.ID {
-			ir(s, i, acceptOutdatedChallengeErrorMessage)
-			s.ChannelMessageDelete(i.Interaction.ChannelID, i.Interaction.Message.ID)
-			return
-		}
+		defer challengeAsChallenge.Unlock()
 
 		challenger := challengeAsChallenge.Challenger
-		challengerMember, _ := s.GuildMember(challengeAsChallenge.ChallengerInteractions[0].GuildID, challenger.ID)
-		challengeeMember, _ := s.GuildMember(challengeAsChallenge.ChallengerInteractions[0].GuildID, acceptor.ID)
+		challengerMember, _ := s.GuildMember(challengeAsChallenge.Channel.GuildID, challenger.ID)
+		challengeeMember, _ := s.GuildMember(challengeAsChallenge.Channel.GuildID, acceptor.ID)
 
-		if bagherRoleInGuild(s, challengeAsChallenge.ChallengerInteractions[0]) == nil {
+		if bagherRoleInGuild(s, challengeAsChallenge.Channel.GuildID) == nil {
 			ir(s, i, roleMissingErrorMessage)
 			return
 		}
 
-		if !userHasBAGHerRoleInGuild(s, challengeAsChallenge.ChallengerInteractions[0], acceptor) {
+		if !userHasBAGHerRoleInGuild(s, challengeAsChallenge.Channel.GuildID, acceptor) {
 			ir(s, i, acceptorNotBAGHerErrorMessage)
 			return
 		}
 
-		playBAGHChannel := findBAGHChannelInGuild(s, challengeAsChallenge.ChallengerInteractions[0])
+		playBAGHChannel := findBAGHChannelInGuild(s, challengeAsChallenge.Channel.GuildID)
 
 		if playBAGHChannel == nil {
 			ir(s, i, playBAGHChannelMissingErrorMessage)
 			return
 		}
 
-		thread, _ := s.ThreadStart(playBAGHChannel.ID,
-			gameThreadTitle(challengerMember, challengeeMember),
-			discordgo.ChannelTypeGuildPrivateThread, 60)
-
-		// make a game object and put the thread reference there
-		newGame := MatchOngoing{
-			Thread:             thread,
-			LastRoundMessageID: "",
-			Challenger:         NewPlayer(challenger),
-			Challengee:         NewPlayer(acceptor),
-			Game:               1,
-			Round:              1,
-		}
+		newGame := NewMatchOngoing(nil, challenger, acceptor, challengeAsChallenge.Rules, rand.Uint64())
 
-		Games[challenger.ID] = &newGame
-		Games[acceptor.ID] = &newGame
+		// hold the match until its thread is ready
+		newGame.Lock()
+		defer newGame.Unlock()
+		defer Games.Save(challengeAsChallenge.Channel.GuildID, newGame)
 
-		msg, _ := s.ChannelMessageSendComplex(thread.ID, &discordgo.MessageSend{
-			Content:    newGame.GameNumberString() + newGame.ToString(),
-			Components: chooseActionOrExitGameButtonRow,
-		})
+		if !Games.Replace(challengeAsChallenge.Channel.GuildID, challengeAsChallenge, newGame, challenger.ID, acceptor.ID) {
+			ir(s, i, acceptOutdatedChallengeErrorMessage)
+			return
+		}
 
-		newGame.LastRoundMessageID = msg.ID
+		thread := startMatchThread(s, playBAGHChannel, gameThreadTitle(challengerMember, challengeeMember), newGame)
 
 		ir(s, i, challengeAcceptConfirmationForChallengee(challenger, thread))
 		s.ChannelMessageDelete(i.Interaction.ChannelID, i.Interaction.Message.ID)
@@ -711,33 +1225,51 @@ var messageComponentHandlers = map[string]func(*discordgo.Session, *discordgo.In
 			})
 		}
 	},
-	"challenge_refuse": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-		refuser := i.Interaction.User
-		challenge, hasRefuser := Games[refuser.ID]
-
-		if !hasRefuser {
-			ir(s, i, refuseOutdatedChallengeErrorMessage)
-			s.ChannelMessageDelete(i.Interaction.ChannelID, i.Interaction.Message.ID)
-			return
+	"challenge_terms_length": handleChallengeTermsSelection(func(draft *ChallengeDraft, gamesToWin int) {
+		draft.setTerms(gamesToWin, draft.Rules.StartingHP, draft.Rules.MaxBoost)
+	}),
+	"challenge_terms_hp": handleChallengeTermsSelection(func(draft *ChallengeDraft, startingHP int) {
+		draft.setTerms(draft.Rules.GamesToWin, startingHP, draft.Rules.MaxBoost)
+	}),
+	"challenge_terms_boost": handleChallengeTermsSelection(func(draft *ChallengeDraft, maxBoost int) {
+		draft.setTerms(draft.Rules.GamesToWin, draft.Rules.StartingHP, maxBoost)
+	}),
+	"challenge_terms_difficulty": handleChallengeTermsSelection(func(draft *ChallengeDraft, level int) {
+		draft.AILevel = ai.Level(level)
+	}),
+	"challenge_terms_clock": handleChallengeTermsSelection(func(draft *ChallengeDraft, clock int) {
+		if clock < len(challengeTermsClocks) {
+			draft.Rules.Clock = challengeTermsClocks[clock]
 		}
-
-		challengeAsChallenge, isChallenge := challenge.(*AwaitingChallengeResponse)
-		if !isChallenge {
-			ir(s, i, refuseOutdatedChallengeErrorMessage)
-			s.ChannelMessageDelete(i.Interaction.ChannelID, i.Interaction.Message.ID)
+	}),
+	"challenge_send": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		challenger := i.Interaction.Member.User
+		draft, found := Games.TakeDraft(i.GuildID, challenger.ID)
+		if !found {
+			irUpdate(s, i, challengeDraftOutdatedErrorMessage)
 			return
 		}
 
-		if challengeAsChallenge.ChallengeeMessage.ID != i.Interaction.Message.ID {
+		sendChallenge(s, i, challenger, draft)
+	},
+	"challenge_cancel": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		Games.TakeDraft(i.GuildID, i.Interaction.Member.User.ID)
+		irUpdate(s, i, challengeCancelledConfirmation)
+	},
+	"challenge_refuse": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		refuser := i.Interaction.User
+		challengeAsChallenge, isChallenge := Games.LockChallengeByMessage(refuser.ID, i.Interaction.Message.ID)
+
+		if !isChallenge {
 			ir(s, i, refuseOutdatedChallengeErrorMessage)
 			s.ChannelMessageDelete(i.Interaction.ChannelID, i.Interaction.Message.ID)
 			return
 		}
+		defer challengeAsChallenge.Unlock()
 
 		challenger := challengeAsChallenge.Challenger
 
-		delete(Games, refuser.ID)
-		delete(Games, challenger.ID)
+		Games.Remove(challengeAsChallenge.Channel.GuildID, challengeAsChallenge, refuser.ID, challenger.ID)
 
 		ir(s, i, challengeRefusedConfirmationToChallengee(challenger))
 		s.ChannelMessageDelete(i.Interaction.ChannelID, i.Interaction.Message.ID)
@@ -761,20 +1293,8 @@ var messageComponentHandlers = map[string]func(*discordgo.Session, *discordgo.In
 		if rescinder == nil {
 			rescinder = i.Interaction.Member.User
 		}
-		challenge, hasRescinder := Games[rescinder.ID]
-
-		if !hasRescinder {
-			s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-				Type: discordgo.InteractionResponseUpdateMessage,
-				Data: &discordgo.InteractionResponseData{
-					Content: rescindOutdatedChallengeErrorMessage,
-					Flags:   discordgo.MessageFlagsEphemeral,
-				},
-			})
-			return
-		}
+		challengeAsChallenge, isChallenge := Games.LockChallenge(i.GuildID, rescinder.ID)
 
-		challengeAsChallenge, isChallenge := challenge.(*AwaitingChallengeResponse)
 		if !isChallenge {
 			s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 				Type: discordgo.InteractionResponseUpdateMessage,
@@ -785,6 +1305,7 @@ var messageComponentHandlers = map[string]func(*discordgo.Session, *discordgo.In
 			})
 			return
 		}
+		defer challengeAsChallenge.Unlock()
 
 		challengee := challengeAsChallenge.Challengee
 
@@ -825,43 +1346,24 @@ var messageComponentHandlers = map[string]func(*discordgo.Session, *discordgo.In
 			Channel:    challengeeDMChannel.ID,
 		})
 
-		delete(Games, rescinder.ID)
-		delete(Games, challengee.ID)
+		Games.Remove(i.GuildID, challengeAsChallenge, rescinder.ID, challengee.ID)
 	},
 	"choose_action": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-		presserID := i.Interaction.Member.User.ID
-		game, found := Games[presserID].(*MatchOngoing)
-
-		if !(found && game.Thread.ID == i.Interaction.ChannelID) {
-			ir(s, i, nonPlayerUsesInGameCommandErrorMessage)
+		game, found := lockPressersMatch(s, i)
+		if !found {
 			return
 		}
+		defer game.Unlock()
 
-		player := game.GetPlayer(presserID)
-
-		player.Interactions.ChooseAction = append(player.Interactions.ChooseAction, i.Interaction)
-
-		var responseData discordgo.InteractionResponseData
-
-		if player.GetAction() == Unchosen {
-			responseData = actionOptionsResponseData
-		} else {
-			responseData = actionSelectedResponseData(player.GetAction())
-		}
-
-		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &responseData,
-		})
+		respondWithActionOptions(s, i, game)
 	},
 	"exit_match": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		presserID := i.Interaction.Member.User.ID
-		game, found := Games[presserID].(*MatchOngoing)
-
-		if !(found && game.Thread.ID == i.Interaction.ChannelID) {
-			ir(s, i, nonPlayerUsesInGameCommandErrorMessage)
+		game, found := lockPressersMatch(s, i)
+		if !found {
 			return
 		}
+		defer game.Unlock()
 
 		player := game.GetPlayer(presserID)
 
@@ -878,15 +1380,11 @@ var messageComponentHandlers = map[string]func(*discordgo.Session, *discordgo.In
 	},
 	"forfeit": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		presserID := i.Interaction.Member.User.ID
-		game, found := Games[presserID].(*MatchOngoing)
-
-		if !(found && game.Thread.ID == i.Interaction.ChannelID) {
-			ir(s, i, nonPlayerUsesInGameCommandErrorMessage)
+		game, found := lockPressersMatch(s, i)
+		if !found {
 			return
 		}
-
-		forfeiter := game.GetPlayer(presserID).User
-		winner := game.GetOtherPlayer(presserID).User
+		defer game.Unlock()
 
 		cleanupButtons(s, game)
 
@@ -900,21 +1398,16 @@ var messageComponentHandlers = map[string]func(*discordgo.Session, *discordgo.In
 			},
 		})
 
-		// remove game session
-		delete(Games, forfeiter.ID)
-		delete(Games, winner.ID)
-
-		// notify thread of forfeit and winner
-		s.ChannelMessageSend(game.Thread.ID, forfeitNotification(forfeiter, winner))
+		forfeitMatch(s, i.GuildID, game, presserID)
 	},
 	"vote_to_draw": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		presserID := i.Interaction.Member.User.ID
-		game, found := Games[presserID].(*MatchOngoing)
-
-		if !(found && game.Thread.ID == i.Interaction.ChannelID) {
-			ir(s, i, nonPlayerUsesInGameCommandErrorMessage)
+		game, found := lockPressersMatch(s, i)
+		if !found {
 			return
 		}
+		defer game.Unlock()
+		defer Games.Save(i.GuildID, game)
 
 		voter := game.GetPlayer(presserID)
 		voter.votedToDraw = true
@@ -941,20 +1434,25 @@ var messageComponentHandlers = map[string]func(*discordgo.Session, *discordgo.In
 		s.ChannelMessageSend(game.Thread.ID, votedToDrawNotification(voter.User))
 
 		if otherPlayer.votedToDraw {
+			stopRoundClock(game)
 			cleanupButtons(s, game)
-			delete(Games, voter.User.ID)
-			delete(Games, otherPlayer.User.ID)
+			var archived *ArchivedMatch
+			if Games.Remove(i.GuildID, game, voter.User.ID, otherPlayer.User.ID) {
+				archived = archiveMatch(i.GuildID, game, OutcomeDrawByVote, engine.NoWinner)
+				finishScoreboard(s, game, OutcomeDrawByVote, engine.NoWinner)
+			}
 			s.ChannelMessageSend(game.Thread.ID, voteToDrawPassesNotification)
+			postRecap(s, game, archived)
 		}
 	},
 	"withdraw_vote_to_draw": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		presserID := i.Interaction.Member.User.ID
-		game, found := Games[presserID].(*MatchOngoing)
-
-		if !(found && game.Thread.ID == i.Interaction.ChannelID) {
-			ir(s, i, nonPlayerUsesInGameCommandErrorMessage)
+		game, found := lockPressersMatch(s, i)
+		if !found {
 			return
 		}
+		defer game.Unlock()
+		defer Games.Save(i.GuildID, game)
 
 		voter := game.GetPlayer(presserID)
 		voter.votedToDraw = false
@@ -978,6 +1476,47 @@ var messageComponentHandlers = map[string]func(*discordgo.Session, *discordgo.In
 
 		s.ChannelMessageSend(game.Thread.ID, voteToDrawWithdrawnNotification(voter.User))
 	},
+	"replay_step": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		arguments := strings.Split(i.MessageComponentData().CustomID, ":")
+		if len(arguments) < 3 {
+			return
+		}
+		step, _ := strconv.Atoi(arguments[2])
+		respondWithReplayStep(s, i, arguments[1], step, discordgo.InteractionResponseUpdateMessage)
+	},
+	"leaderboard_page": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		_, pageString, _ := strings.Cut(i.MessageComponentData().CustomID, ":")
+		page, _ := strconv.Atoi(pageString)
+		respondWithLeaderboardPage(s, i, page, discordgo.InteractionResponseUpdateMessage)
+	},
+	"queue_leave": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		if _, queued := Queue.Leave(i.GuildID, i.Interaction.Member.User.ID); !queued {
+			irUpdate(s, i, leaveQueueOutdatedErrorMessage)
+			return
+		}
+		irUpdate(s, i, queueLeftConfirmation)
+	},
+	"match_watch": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		if !userHasBAGHerRoleInGuild(s, i.GuildID, i.Interaction.Member.User) {
+			ir(s, i, spectatorNotBAGHerErrorMessage)
+			return
+		}
+
+		// the challenger may have gone on to another match, so make sure it's this scoreboard's
+		_, challengerID, _ := strings.Cut(i.MessageComponentData().CustomID, ":")
+		game, found := Games.LockMatch(i.GuildID, challengerID)
+		if !found {
+			ir(s, i, watchFinishedMatchErrorMessage)
+			return
+		}
+		defer game.Unlock()
+		if game.Scoreboard == nil || game.Scoreboard.ID != i.Interaction.Message.ID {
+			ir(s, i, watchFinishedMatchErrorMessage)
+			return
+		}
+
+		spectateMatch(s, i, game)
+	},
 	"clear_notification": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		s.ChannelMessageDelete(i.Interaction.ChannelID, i.Interaction.Message.ID)
 	},
@@ -989,7 +1528,30 @@ func handleApplicationCommand(s *discordgo.Session, i *discordgo.InteractionCrea
 		applicationCommandsAndHandlers[i.ApplicationCommandData().Name].Handler(s, i)
 	case discordgo.InteractionMessageComponent:
 		buttonID := i.MessageComponentData().CustomID
-		messageComponentHandlers[buttonID](s, i)
+		// some custom IDs carry an argument after a colon, like a page number
+		handlerName, _, _ := strings.Cut(buttonID, ":")
+		messageComponentHandlers[handlerName](s, i)
+	}
+}
+
+// deletes what spectators say in the threads of matches they're watching.
+// Discord has no way to make a thread read-only for some of its members,
+// so this is all that keeps spectators quiet, and it needs BAGH to have
+// the Manage Messages permission in play-bagh, which it grants itself.
+func handleMessageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
+	if m.GuildID == "" || m.Author == nil || m.Author.Bot {
+		return
+	}
+
+	game, found := Games.LockMatchInThread(m.GuildID, m.ChannelID)
+	if !found {
+		return
+	}
+	isSpectator := game.IsSpectator(m.Author.ID)
+	game.Unlock()
+
+	if isSpectator {
+		s.ChannelMessageDelete(m.ChannelID, m.ID)
 	}
 }
 
@@ -1017,20 +1579,109 @@ func handleGuildCreate(s *discordgo.Session, gc *discordgo.GuildCreate) {
 	}
 }
 
+var readyOnce sync.Once
+
 func handleReady(s *discordgo.Session, ready *discordgo.Ready) {
+	// Ready is sent again whenever the bot reconnects, but saved sessions
+	// only need to be loaded, and matchmaking started, once
+	readyOnce.Do(func() {
+		restoreSessions(s)
+		go runMatchmaking(s)
+	})
+}
+
+// puts back every session saved before the bot stopped,
+// dropping the ones that can't be picked back up
+func restoreSessions(s *discordgo.Session) {
+	if Store == nil {
+		return
+	}
+
+	records, err := Store.Load()
+	if err != nil {
+		fmt.Println("error loading sessions: ", err)
+	}
+
+	for _, record := range records {
+		if !restoreSession(s, record) {
+			Store.DeleteRecord(record)
+		}
+	}
+}
+
+func restoreSession(s *discordgo.Session, record SessionRecord) bool {
+	ch := findBAGHChannelInGuild(s, record.GuildID)
+	if ch == nil {
+		return false
+	}
+
+	if record.Challenge != nil {
+		challenge := record.challenge()
+		// the challengee was never sent the challenge, so they can't answer it
+		if challenge.ChallengeeMessage == nil {
+			return false
+		}
+		challenge.Channel = ch
+		// challenges saved before they could expire start waiting from now
+		if challenge.Issued.IsZero() {
+			challenge.Issued = time.Now()
+		}
+		if !Games.Claim(record.GuildID, challenge, challenge.Challenger.ID, challenge.Challengee.ID) {
+			return false
+		}
+		scheduleChallengeExpiry(s, record.GuildID, challenge)
+		Games.Save(record.GuildID, challenge)
+		return true
+	}
+
+	game, err := record.match()
+	if err != nil {
+		fmt.Println("error restoring match: ", err)
+		return false
+	}
+
+	game.Lock()
+	defer game.Unlock()
+
+	playerIDs := []string{game.Challenger.User.ID}
+	if !game.IsAgainstBAGH() {
+		playerIDs = append(playerIDs, game.Challengee.User.ID)
+	}
+	if !Games.Claim(record.GuildID, game, playerIDs...) {
+		return false
+	}
+
+	// the thread is still there, so send a fresh round message
+	// in place of the one from before the restart
+	if !restoreMatchThread(s, record.GuildID, ch, game) {
+		cleanupButtons(s, game)
+		msg, _ := sendRoundMessage(s, game.Thread.ID, game, matchRestoredNotification+"\n")
+		if msg != nil {
+			game.LastRoundMessageID = msg.ID
+		}
+	}
+
+	// the round starts over on the clock, since nobody could play while BAGH was down
+	startRoundClock(s, record.GuildID, game)
+	updateScoreboard(s, game)
+
+	Games.Save(record.GuildID, game)
+	return true
 }
 
 func handleGuildMemberRemove(s *discordgo.Session, gmr *discordgo.GuildMemberRemove) {
-	session, hasSession := Games[gmr.Member.User.ID]
+	Queue.Leave(gmr.GuildID, gmr.Member.User.ID)
+
+	session, hasSession := Games.Lock(gmr.GuildID, gmr.Member.User.ID)
 	if hasSession {
-		delete(Games, gmr.Member.User.ID)
+		defer session.Unlock()
+		Games.RemoveEveryone(gmr.GuildID, session)
 		challenge, isChallenge := session.(*AwaitingChallengeResponse)
 
 		var dmChannel *discordgo.Channel
 
 		if isChallenge {
 			if challenge.Challenger.ID == gmr.Member.User.ID {
-				delete(Games, challenge.Challengee.ID)
 				dmChannel, _ = s.UserChannelCreate(challenge.Challengee.ID)
 				s.ChannelMessageDelete(dmChannel.ID, challenge.ChallengeeMessage.ID)
 				s.ChannelMessageSendComplex(dmChannel.ID, &discordgo.MessageSend{
@@ -1038,7 +1689,6 @@ func handleGuildMemberRemove(s *discordgo.Session, gmr *discordgo.GuildMemberRem
 					Components: clearNotificationButton,
 				})
 			} else {
-				delete(Games, challenge.Challenger.ID)
 				dmChannel, _ = s.UserChannelCreate(challenge.Challenger.ID)
 				s.ChannelMessageSendComplex(dmChannel.ID, &discordgo.MessageSend{
 					Content:    memberRemovedNotification(challenge.Challengee),
@@ -1049,7 +1699,9 @@ func handleGuildMemberRemove(s *discordgo.Session, gmr *discordgo.GuildMemberRem
 			game, _ := session.(*MatchOngoing)
 			leaver := game.GetPlayer(gmr.Member.User.ID)
 			stayer := game.GetOtherPlayer(gmr.Member.User.ID)
-			delete(Games, stayer.User.ID)
+			archiveMatch(gmr.GuildID, game, OutcomeMemberRemoved, game.playerIndex(stayer.User.ID))
+			finishScoreboard(s, game, OutcomeMemberRemoved, game.playerIndex(stayer.User.ID))
+			stopRoundClock(game)
 			cleanupButtons(s, game)
 			dmChannel, _ = s.UserChannelCreate(stayer.User.ID)
 			s.ChannelMessageSendComplex(dmChannel.ID, &discordgo.MessageSend{
@@ -1062,15 +1714,11 @@ func handleGuildMemberRemove(s *discordgo.Session, gmr *discordgo.GuildMemberRem
 }
 
 func handleGuildLeave(_ *discordgo.Session, gd *discordgo.GuildDelete) {
-	for id, session := range Games {
-		challenge, isChallenge := session.(*AwaitingChallengeResponse)
-		if isChallenge && challenge.Channel.GuildID == gd.Guild.ID {
-			defer delete(Games, id)
-		} else {
-			game, _ := session.(*MatchOngoing)
-			if game.Thread.GuildID == gd.Guild.ID {
-				defer delete(Games, id)
-			}
-		}
+	// an outage makes the guild unavailable for a while without removing the bot,
+	// and its matches should still be there when it's back
+	if gd.Unavailable {
+		return
 	}
+	Games.RemoveGuild(gd.Guild.ID)
+	Queue.RemoveGuild(gd.Guild.ID)
 }
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"hwacha/bagh/ai"
+	"hwacha/bagh/engine"
+)
+
+// how a finished match came to an end
+type Outcome string
+
+const (
+	OutcomeWin           Outcome = "win"
+	OutcomeDraw          Outcome = "draw"
+	OutcomeDrawByVote    Outcome = "draw-by-vote"
+	OutcomeForfeit       Outcome = "forfeit"
+	OutcomeMemberRemoved Outcome = "member-removed"
+)
+
+type ArchivedPlayer struct {
+	ID       string
+	Username string
+}
+
+// ArchivedMatch is everything kept about a finished match.
+// Players are the challenger then the challengee, and Winner indexes them,
+// or is engine.NoWinner for a draw.
+type ArchivedMatch struct {
+	ID          string
+	GuildID     string
+	Players     [2]ArchivedPlayer
+	AgainstBAGH bool
+	AILevel     ai.Level
+	Rules       engine.Ruleset
+	Seed        uint64
+	Started     time.Time
+	Ended       time.Time
+	Outcome     Outcome
+	Winner      int
+	Rounds      []engine.RoundRecord
+}
+
+// MatchHistory archives finished matches to a directory, one JSON file per match,
+// named after the match's ID.
+type MatchHistory struct {
+	dir string
+}
+
+func NewMatchHistory(dir string) (*MatchHistory, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &MatchHistory{dir: dir}, nil
+}
+
+// Archive gives the match an ID and saves it.
+func (history *MatchHistory) Archive(match *ArchivedMatch) error {
+	// IDs come from the seed, which is random for Discord matches,
+	// with a count on the end in the rare case that's taken
+	base := strconv.FormatUint(match.Seed, 36)
+	for n := 1; ; n++ {
+		id := base
+		if n > 1 {
+			id += "-" + strconv.Itoa(n)
+		}
+		file, err := os.OpenFile(history.path(id), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		match.ID = id
+		data, err := json.Marshal(match)
+		if err == nil {
+			_, err = file.Write(data)
+		}
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(file.Name())
+		}
+		return err
+	}
+}
+
+func (history *MatchHistory) path(id string) string {
+	return filepath.Join(history.dir, id+".json")
+}
+
+// Get reads the match archived with the given ID.
+func (history *MatchHistory) Get(id string) (*ArchivedMatch, error) {
+	if id == "" || strings.ContainsAny(id, `/\.`) {
+		return nil, os.ErrNotExist
+	}
+	return ReadArchivedMatch(history.path(id))
+}
+
+// Matches reads every archived match that keep returns true for.
+// A nil keep keeps them all.
+func (history *MatchHistory) Matches(keep func(match *ArchivedMatch) bool) ([]*ArchivedMatch, error) {
+	entries, err := os.ReadDir(history.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []*ArchivedMatch{}
+	errs := []error{}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		match, err := ReadArchivedMatch(filepath.Join(history.dir, entry.Name()))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if keep == nil || keep(match) {
+			matches = append(matches, match)
+		}
+	}
+	return matches, errors.Join(errs...)
+}
+
+func ReadArchivedMatch(path string) (*ArchivedMatch, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	match := &ArchivedMatch{}
+	if err := json.Unmarshal(data, match); err != nil {
+		return nil, errors.New(filepath.Base(path) + ": " + err.Error())
+	}
+	return match, nil
+}
+
+// rates the finished match and archives it, if there's a history to archive it to.
+// The returned match only has an ID if it was archived.
+// The caller must hold the match's lock.
+func archiveMatch(guildID string, game *MatchOngoing, outcome Outcome, winner int) *ArchivedMatch {
+	players := [2]ArchivedPlayer{}
+	for i, player := range game.GetPlayers() {
+		players[i] = ArchivedPlayer{ID: player.User.ID, Username: player.User.Username}
+	}
+	match := &ArchivedMatch{
+		GuildID:     guildID,
+		Players:     players,
+		AgainstBAGH: game.IsAgainstBAGH(),
+		AILevel:     game.AILevel,
+		Rules:       game.State.Rules,
+		Seed:        game.Seed,
+		Started:     game.Started,
+		Ended:       time.Now(),
+		Outcome:     outcome,
+		Winner:      winner,
+		Rounds:      game.Rounds,
+	}
+
+	rateMatch(match)
+
+	if History == nil {
+		return match
+	}
+	if err := History.Archive(match); err != nil {
+		fmt.Println("error archiving match: ", err)
+	}
+	return match
+}
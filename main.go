@@ -6,6 +6,11 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
+
+	"hwacha/bagh/ai"
+	"hwacha/bagh/engine"
+	"hwacha/bagh/rating"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/joho/godotenv"
@@ -14,19 +19,96 @@ import (
 var (
 	CommandLine   bool
 	Secret        bool
+	JSON          bool
+	Seed          uint64
+	RulesetName   string
+	ReplayFile    string
+	AILevelName   string
 	ApplicationID string
 	token         string
-	Games         = make(map[string]SessionState)
+	Games         = NewSessionManager()
+	Store         *SessionStore
+	History       *MatchHistory
+	Ratings       *RatingStore
+	Queue         = NewMatchmakingQueue()
+	// how long a challenge waits for an answer, or forever if 0
+	ChallengeExpiry = defaultChallengeExpiry
 )
 
 func init() {
 	flag.BoolVar(&CommandLine, "c", false, "Play on command line")
 	flag.BoolVar(&Secret, "s", false, "Make command line action inputs secret")
-	flag.Parse()
+	flag.BoolVar(&JSON, "j", false, "Print command line action logs as JSON events")
+	flag.Uint64Var(&Seed, "seed", 0, "Seed for shield mending on the command line (random if 0)")
+	flag.StringVar(&RulesetName, "rules", engine.Classic.Name, "Ruleset preset to play on the command line (classic, quick, long, high-hp)")
+	flag.StringVar(&AILevelName, "ai", "", "Make p2 a computer opponent on the command line, playing at this level (random, greedy, lookahead, equilibrium)")
+	flag.StringVar(&ReplayFile, "replay", "", "Print the match archived in this file round by round")
+}
+
+// where solved strategy tables are written and loaded from
+func strategyDir() string {
+	if dir := os.Getenv("STRATEGY_DIR"); dir != "" {
+		return dir
+	}
+	return "strategies"
+}
+
+// where ongoing matches and pending challenges are saved between restarts
+func sessionDir() string {
+	if dir := os.Getenv("SESSION_DIR"); dir != "" {
+		return dir
+	}
+	return "sessions"
+}
+
+// where finished matches are archived
+func historyDir() string {
+	if dir := os.Getenv("HISTORY_DIR"); dir != "" {
+		return dir
+	}
+	return "history"
+}
+
+// where players' ratings are kept
+func ratingDir() string {
+	if dir := os.Getenv("RATING_DIR"); dir != "" {
+		return dir
+	}
+	return "ratings"
+}
+
+const defaultChallengeExpiry = 15 * time.Minute
+
+// how long challenges wait for an answer, 15 minutes unless set
+func challengeExpiry() (time.Duration, error) {
+	if expiry := os.Getenv("CHALLENGE_EXPIRY"); expiry != "" {
+		return time.ParseDuration(expiry)
+	}
+	return defaultChallengeExpiry, nil
+}
+
+// which rating system ranked matches update, elo unless set
+func ratingSystem() (rating.System, error) {
+	if name := os.Getenv("RATING_SYSTEM"); name != "" {
+		return rating.SystemByName(name)
+	}
+	return rating.SystemByName("elo")
 }
 
 func main() {
-	if CommandLine {
+	flag.Parse()
+
+	if flag.Arg(0) == "solve" {
+		runSolveCommandLine(flag.Args()[1:])
+		return
+	}
+
+	if ReplayFile != "" {
+		runReplayCommandLine(ReplayFile)
+		return
+	}
+
+	if CommandLine || AILevelName != "" {
 		runGameCommandLine()
 		return
 	}
@@ -35,6 +117,40 @@ func main() {
 	token = os.Getenv("BOT_TOKEN")
 	ApplicationID = os.Getenv("APPLICATION_ID")
 
+	tables, err := ai.LoadStrategyTables(strategyDir())
+	if err != nil {
+		fmt.Println("error loading strategy tables: ", err)
+	}
+	for _, table := range tables {
+		fmt.Println("Loaded strategy table for " + table.Rules.Name + " rules.")
+	}
+
+	Store, err = NewSessionStore(sessionDir())
+	if err != nil {
+		fmt.Println("error opening session store: ", err)
+	} else {
+		Games.UseStore(Store)
+	}
+
+	History, err = NewMatchHistory(historyDir())
+	if err != nil {
+		fmt.Println("error opening match history: ", err)
+	}
+
+	system, err := ratingSystem()
+	if err == nil {
+		Ratings, err = NewRatingStore(ratingDir(), system)
+	}
+	if err != nil {
+		fmt.Println("error opening ratings: ", err)
+	}
+
+	ChallengeExpiry, err = challengeExpiry()
+	if err != nil {
+		fmt.Println("error reading challenge expiry: ", err)
+		ChallengeExpiry = defaultChallengeExpiry
+	}
+
 	dg, err := discordgo.New("Bot " + token)
 	if err != nil {
 		fmt.Println("error creating Discord session: ", err)
@@ -46,6 +162,7 @@ func main() {
 	dg.AddHandler(handleGuildMemberRemove)
 	dg.AddHandler(handleGuildLeave)
 	dg.AddHandler(handleApplicationCommand)
+	dg.AddHandler(handleMessageCreate)
 
 	dg.Identify.Intents = discordgo.IntentsGuilds | discordgo.IntentsGuildMessages | discordgo.IntentsDirectMessages | discordgo.IntentsGuildMembers
 
@@ -8,25 +8,17 @@ type Interactions struct {
 }
 
 type Player struct {
-	User               *discordgo.User
-	Interactions       Interactions
-	Wins               int
-	HP                 int
-	ShieldBreakCounter int
-	Priority           int
-	Boost              int
-	currentAction      Action
-	actionLocked       bool
-	votedToDraw        bool
+	User          *discordgo.User
+	Interactions  Interactions
+	currentAction Action
+	actionLocked  bool
+	votedToDraw   bool
 }
 
 func NewPlayer(u *discordgo.User) Player {
 	return Player{
 		User:          u,
 		Interactions:  Interactions{ChooseAction: nil, ExitGame: nil},
-		HP:            BASE_MAX_HEALTH,
-		Priority:      0,
-		Boost:         0,
 		currentAction: Unchosen,
 		actionLocked:  false,
 	}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"hwacha/bagh/engine"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// how far apart two queued players' ratings can be to be paired,
+// widening the longer they wait
+const (
+	queueWindowBase     = 100.0
+	queueWindowGrowth   = 50.0
+	queueWindowInterval = 15 * time.Second
+	matchmakingInterval = 5 * time.Second
+)
+
+// queued matches are classic, with a clock so nobody can stall a ranked match
+var queuedMatchRules = func() engine.Ruleset {
+	rules := engine.Classic
+	rules.Clock = engine.RoundClock{Limit: 2 * time.Minute, OnTimeout: engine.TimeoutGuard, MaxTimeouts: 3}
+	return rules
+}()
+
+type QueueEntry struct {
+	User        *discordgo.User
+	Rating      float64
+	Joined      time.Time
+	Interaction *discordgo.Interaction
+}
+
+func (entry *QueueEntry) window(now time.Time) float64 {
+	waited := now.Sub(entry.Joined)
+	return queueWindowBase + queueWindowGrowth*float64(waited/queueWindowInterval)
+}
+
+type QueuePair struct {
+	GuildID string
+	Players [2]*QueueEntry
+}
+
+// MatchmakingQueue holds every guild's pool of players waiting for a ranked match.
+type MatchmakingQueue struct {
+	mu      sync.Mutex
+	entries map[string][]*QueueEntry
+}
+
+func NewMatchmakingQueue() *MatchmakingQueue {
+	return &MatchmakingQueue{entries: make(map[string][]*QueueEntry)}
+}
+
+// Join adds the entry to the guild's pool, unless its user is already in it.
+func (q *MatchmakingQueue) Join(guildID string, entry *QueueEntry) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if slices.ContainsFunc(q.entries[guildID], func(queued *QueueEntry) bool {
+		return queued.User.ID == entry.User.ID
+	}) {
+		return false
+	}
+	q.entries[guildID] = append(q.entries[guildID], entry)
+	return true
+}
+
+// Leave takes the user out of the guild's pool and returns their entry.
+func (q *MatchmakingQueue) Leave(guildID string, userID string) (*QueueEntry, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	entries := q.entries[guildID]
+	index := slices.IndexFunc(entries, func(queued *QueueEntry) bool {
+		return queued.User.ID == userID
+	})
+	if index == -1 {
+		return nil, false
+	}
+	entry := entries[index]
+	q.entries[guildID] = slices.Delete(entries, index, index+1)
+	if len(q.entries[guildID]) == 0 {
+		delete(q.entries, guildID)
+	}
+	return entry, true
+}
+
+func (q *MatchmakingQueue) RemoveGuild(guildID string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.entries, guildID)
+}
+
+// Pair takes every pair of players that can be matched out of the pools.
+// Whoever has waited longest is paired first, with the closest rating in
+// both players' windows. Players that busy reports are dropped from the pool.
+func (q *MatchmakingQueue) Pair(now time.Time, busy func(guildID string, userID string) bool) []QueuePair {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	pairs := []QueuePair{}
+	for guildID, entries := range q.entries {
+		entries = slices.DeleteFunc(entries, func(entry *QueueEntry) bool {
+			return busy(guildID, entry.User.ID)
+		})
+		// entries are kept in the order they joined
+		for i := 0; i < len(entries); i++ {
+			player := entries[i]
+			best := -1
+			for j := i + 1; j < len(entries); j++ {
+				opponent := entries[j]
+				gap := math.Abs(player.Rating - opponent.Rating)
+				if gap > player.window(now) || gap > opponent.window(now) {
+					continue
+				}
+				if best == -1 || gap < math.Abs(player.Rating-entries[best].Rating) {
+					best = j
+				}
+			}
+			if best == -1 {
+				continue
+			}
+			pairs = append(pairs, QueuePair{GuildID: guildID, Players: [2]*QueueEntry{player, entries[best]}})
+			entries = slices.Delete(entries, best, best+1)
+			entries = slices.Delete(entries, i, i+1)
+			i--
+		}
+		if len(entries) == 0 {
+			delete(q.entries, guildID)
+		} else {
+			q.entries[guildID] = entries
+		}
+	}
+	return pairs
+}
@@ -0,0 +1,141 @@
+// Package rating keeps players' competitive ratings up to date as they finish matches.
+package rating
+
+import (
+	"errors"
+	"math"
+)
+
+// Scores for the player being rated.
+const (
+	Loss = 0.0
+	Draw = 0.5
+	Win  = 1.0
+)
+
+// Rating is a player's standing under some System.
+// Deviation and Volatility are only used by Glicko-2.
+type Rating struct {
+	Value      float64
+	Deviation  float64
+	Volatility float64
+	Matches    int
+}
+
+// System updates ratings one match at a time.
+type System interface {
+	Name() string
+	Initial() Rating
+	// Update returns player's rating after scoring score against opponent.
+	Update(player Rating, opponent Rating, score float64) Rating
+}
+
+// SystemByName returns the system called name, "elo" or "glicko2".
+func SystemByName(name string) (System, error) {
+	switch name {
+	case "elo":
+		return Elo{K: 32}, nil
+	case "glicko2":
+		return Glicko2{Tau: 0.5}, nil
+	}
+	return nil, errors.New("unknown rating system " + name)
+}
+
+// Elo is the classic rating system, where K is the most a rating can move in one match.
+type Elo struct {
+	K float64
+}
+
+func (Elo) Name() string {
+	return "elo"
+}
+
+func (Elo) Initial() Rating {
+	return Rating{Value: 1500}
+}
+
+func (elo Elo) Update(player Rating, opponent Rating, score float64) Rating {
+	expected := 1 / (1 + math.Pow(10, (opponent.Value-player.Value)/400))
+	player.Value += elo.K * (score - expected)
+	player.Matches++
+	return player
+}
+
+// Glicko2 is Glickman's Glicko-2 system, treating every match as its own rating period.
+// Tau limits how quickly volatility can change.
+type Glicko2 struct {
+	Tau float64
+}
+
+// converts between the Glicko scale and the Glicko-2 scale
+const glicko2Scale = 173.7178
+
+func (Glicko2) Name() string {
+	return "glicko2"
+}
+
+func (Glicko2) Initial() Rating {
+	return Rating{Value: 1500, Deviation: 350, Volatility: 0.06}
+}
+
+func (glicko Glicko2) Update(player Rating, opponent Rating, score float64) Rating {
+	mu := (player.Value - 1500) / glicko2Scale
+	phi := player.Deviation / glicko2Scale
+	opponentMu := (opponent.Value - 1500) / glicko2Scale
+	opponentPhi := opponent.Deviation / glicko2Scale
+
+	g := 1 / math.Sqrt(1+3*opponentPhi*opponentPhi/(math.Pi*math.Pi))
+	expected := 1 / (1 + math.Exp(-g*(mu-opponentMu)))
+	variance := 1 / (g * g * expected * (1 - expected))
+	delta := variance * g * (score - expected)
+
+	sigma := glicko.volatility(phi, player.Volatility, variance, delta)
+
+	phiStar := math.Sqrt(phi*phi + sigma*sigma)
+	newPhi := 1 / math.Sqrt(1/(phiStar*phiStar)+1/variance)
+	newMu := mu + newPhi*newPhi*g*(score-expected)
+
+	return Rating{
+		Value:      newMu*glicko2Scale + 1500,
+		Deviation:  newPhi * glicko2Scale,
+		Volatility: sigma,
+		Matches:    player.Matches + 1,
+	}
+}
+
+// finds the new volatility with the Illinois algorithm, as in step 5 of Glickman's paper
+func (glicko Glicko2) volatility(phi float64, sigma float64, variance float64, delta float64) float64 {
+	const epsilon = 0.000001
+
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		denominator := phi*phi + variance + ex
+		return ex*(delta*delta-phi*phi-variance-ex)/(2*denominator*denominator) - (x-a)/(glicko.Tau*glicko.Tau)
+	}
+
+	boundA := a
+	var boundB float64
+	if delta*delta > phi*phi+variance {
+		boundB = math.Log(delta*delta - phi*phi - variance)
+	} else {
+		k := 1.0
+		for f(a-k*glicko.Tau) < 0 {
+			k++
+		}
+		boundB = a - k*glicko.Tau
+	}
+
+	fA, fB := f(boundA), f(boundB)
+	for math.Abs(boundB-boundA) > epsilon {
+		c := boundA + (boundA-boundB)*fA/(fB-fA)
+		fc := f(c)
+		if fc*fB <= 0 {
+			boundA, fA = boundB, fB
+		} else {
+			fA /= 2
+		}
+		boundB, fB = c, fc
+	}
+	return math.Exp(boundA / 2)
+}
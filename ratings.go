@@ -0,0 +1,159 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"hwacha/bagh/rating"
+)
+
+// RatingStore keeps every guild's ratings in a JSON file per guild,
+// mapping user IDs to ratings.
+type RatingStore struct {
+	mu     sync.Mutex
+	dir    string
+	system rating.System
+}
+
+func NewRatingStore(dir string, system rating.System) (*RatingStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &RatingStore{dir: dir, system: system}, nil
+}
+
+// a player's place on a leaderboard
+type Standing struct {
+	UserID string
+	Rating rating.Rating
+}
+
+func (store *RatingStore) path(guildID string) string {
+	return filepath.Join(store.dir, guildID+".json")
+}
+
+// the caller must hold the store's lock
+func (store *RatingStore) load(guildID string) (map[string]rating.Rating, error) {
+	ratings := make(map[string]rating.Rating)
+	data, err := os.ReadFile(store.path(guildID))
+	if errors.Is(err, os.ErrNotExist) {
+		return ratings, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &ratings); err != nil {
+		return nil, err
+	}
+	return ratings, nil
+}
+
+// the caller must hold the store's lock
+func (store *RatingStore) save(guildID string, ratings map[string]rating.Rating) error {
+	data, err := json.Marshal(ratings)
+	if err != nil {
+		return err
+	}
+	temp, err := os.CreateTemp(store.dir, ".ratings-*")
+	if err != nil {
+		return err
+	}
+	_, err = temp.Write(data)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+	return os.Rename(temp.Name(), store.path(guildID))
+}
+
+// Get returns the user's rating in the guild, or the initial rating if they haven't got one.
+func (store *RatingStore) Get(guildID string, userID string) (rating.Rating, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	ratings, err := store.load(guildID)
+	if err != nil {
+		return store.system.Initial(), err
+	}
+	if r, found := ratings[userID]; found {
+		return r, nil
+	}
+	return store.system.Initial(), nil
+}
+
+// Record updates both players' ratings after a match,
+// where score is how the first player did against the second.
+func (store *RatingStore) Record(guildID string, userIDs [2]string, score float64) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	ratings, err := store.load(guildID)
+	if err != nil {
+		return err
+	}
+
+	before := [2]rating.Rating{}
+	for i, userID := range userIDs {
+		r, found := ratings[userID]
+		if !found {
+			r = store.system.Initial()
+		}
+		before[i] = r
+	}
+	ratings[userIDs[0]] = store.system.Update(before[0], before[1], score)
+	ratings[userIDs[1]] = store.system.Update(before[1], before[0], 1-score)
+
+	return store.save(guildID, ratings)
+}
+
+// Leaderboard returns everyone rated in the guild, best first.
+func (store *RatingStore) Leaderboard(guildID string) ([]Standing, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	ratings, err := store.load(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	standings := make([]Standing, 0, len(ratings))
+	for userID, r := range ratings {
+		standings = append(standings, Standing{UserID: userID, Rating: r})
+	}
+	slices.SortFunc(standings, func(a Standing, b Standing) int {
+		return cmp.Or(
+			cmp.Compare(b.Rating.Value, a.Rating.Value),
+			cmp.Compare(b.Rating.Matches, a.Rating.Matches),
+			strings.Compare(a.UserID, b.UserID),
+		)
+	})
+	return standings, nil
+}
+
+// rates a finished match between two people.
+// Matches against BAGH, and ones that ended because a member left, aren't rated.
+func rateMatch(match *ArchivedMatch) {
+	if Ratings == nil || match.AgainstBAGH || match.Outcome == OutcomeMemberRemoved {
+		return
+	}
+
+	score := rating.Draw
+	switch match.Winner {
+	case 0:
+		score = rating.Win
+	case 1:
+		score = rating.Loss
+	}
+
+	err := Ratings.Record(match.GuildID, [2]string{match.Players[0].ID, match.Players[1].ID}, score)
+	if err != nil {
+		fmt.Println("error rating match: ", err)
+	}
+}
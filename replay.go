@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"hwacha/bagh/engine"
+)
+
+// ReplayStep is where a recorded match stood after one of its rounds,
+// with the events that round produced. The first step is the start of the
+// match, before any rounds, and has no events.
+type ReplayStep struct {
+	State  engine.State
+	Events []engine.Event
+}
+
+// replays the archived match's rounds, checking each leads where it was recorded to
+func replaySteps(match *ArchivedMatch) ([]ReplayStep, error) {
+	steps := []ReplayStep{{State: engine.NewState(match.Rules)}}
+	err := engine.Replay(match.Rules, match.Rounds, func(before engine.State, round engine.RoundRecord, events []engine.Event) {
+		steps = append(steps, ReplayStep{State: round.State, Events: events})
+	})
+	return steps, err
+}
+
+// prints the match archived at path round by round.
+// The file can be an archived match's JSON, or the match written in notation.
+func runReplayCommandLine(path string) {
+	read := ReadArchivedMatch
+	if filepath.Ext(path) == notationFileExtension {
+		read = readNotationFile
+	}
+	match, err := read(path)
+	if err != nil {
+		fmt.Println("Couldn't read match:", err)
+		return
+	}
+	if err := match.Rules.Validate(); err != nil {
+		fmt.Println("Invalid ruleset:", err)
+		return
+	}
+	steps, err := replaySteps(match)
+	if err != nil {
+		fmt.Println("Couldn't replay match:", err)
+		return
+	}
+
+	names := [2]string{match.Players[0].Username, match.Players[1].Username}
+	fmt.Println("Match: " + match.ID)
+	fmt.Println("Players: " + names[0] + " vs " + names[1])
+	fmt.Println("Rules: " + match.Rules.Name + " (" + match.Rules.Describe() + ")")
+
+	for _, step := range steps {
+		if len(step.Events) > 0 {
+			if JSON {
+				data, _ := engine.RenderJSON(step.Events)
+				fmt.Println(string(data))
+			} else {
+				fmt.Println(engine.RenderPlain(step.Events, names))
+			}
+		}
+		if isMatchOver, _ := step.State.IsMatchOver(); !isMatchOver {
+			fmt.Println(step.State.ToString(names))
+		}
+	}
+
+	fmt.Println("Outcome: " + string(match.Outcome))
+}
+
+const notationFileExtension = ".bagh"
+
+// writes the archived match down in notation
+func matchNotation(match *ArchivedMatch) engine.MatchNotation {
+	notation := engine.MatchNotation{
+		Players: [2]string{match.Players[0].Username, match.Players[1].Username},
+		Rules:   match.Rules,
+		Seed:    match.Seed,
+		Date:    match.Started,
+		Result:  engine.MatchResult(match.Winner),
+		Rounds:  match.Rounds,
+	}
+	if match.Outcome != OutcomeWin && match.Outcome != OutcomeDraw {
+		notation.Termination = string(match.Outcome)
+	}
+	return notation
+}
+
+// reads a match written in notation as if it had been archived.
+// Its players are only known by name, and how it ended is a guess from its result.
+func readNotationFile(path string) (*ArchivedMatch, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	notation, err := engine.ParseNotation(string(data))
+	if err != nil {
+		return nil, errors.New(filepath.Base(path) + ": " + err.Error())
+	}
+
+	match := &ArchivedMatch{
+		ID:      strings.TrimSuffix(filepath.Base(path), notationFileExtension),
+		Players: [2]ArchivedPlayer{{Username: notation.Players[0]}, {Username: notation.Players[1]}},
+		Rules:   notation.Rules,
+		Seed:    notation.Seed,
+		Started: notation.Date,
+		Outcome: Outcome(notation.Termination),
+		Winner:  engine.NoWinner,
+		Rounds:  notation.Rounds,
+	}
+	switch notation.Result {
+	case "1-0":
+		match.Winner = 0
+	case "0-1":
+		match.Winner = 1
+	}
+	if match.Outcome == "" {
+		match.Outcome = OutcomeWin
+		if match.Winner == engine.NoWinner {
+			match.Outcome = OutcomeDraw
+		}
+	}
+	return match, nil
+}
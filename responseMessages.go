@@ -1,6 +1,13 @@
 package main
 
 import (
+	"math"
+	"strconv"
+	"time"
+
+	"hwacha/bagh/ai"
+	"hwacha/bagh/engine"
+
 	"github.com/bwmarrin/discordgo"
 )
 
@@ -9,14 +16,24 @@ const (
 	acceptOutdatedChallengeErrorMessage = "You've tried to accept an outdated challenge."
 	alreadyBAGHerErrorMessage           = "You're already a `bagher`!"
 	alreadyNotBAGHerErrorMessage        = "You're not a `bagher` already!"
+	alreadyQueuedErrorMessage           = "You're already in the queue."
 	baghOptions                         = "Welcome to BAGH! You have access to the following slash commands:\n" +
 		"- `/join`: adds the `bagher` role and allows you to issue and accept challenges from other BAGH players.\n" +
 		"- `/leave`: removes the `bagher` role. You won't be able to issue challenges, and other player's can't challenge you.\n" +
 		"- `/rules`: enumerates the rules of BAGH.\n" +
 		"- `/bagh`: gives help and instructions.\n" +
+		"- `/stats`: shows your record in this server, or someone else's.\n" +
+		"- `/leaderboard`: ranks this server's players by rating.\n" +
+		"- `/queue`: finds you a ranked match against someone close to your rating.\n" +
+		"- `/spectate`: watches someone's match.\n" +
+		"- `/replay`: steps through a finished match.\n" +
+		"- `/export`: writes a finished match down in BAGH notation.\n" +
 		"You can also use the following user commands. To use a user command, right-click on a user (in this server's members list), and go to Apps.\n" +
-		"- `challenge`: challenges someone to a BAGH match."
+		"- `challenge`: challenges someone to a BAGH match, on terms you choose."
+	bothPlayersOutOfTimeoutsNotification                = "Both players have run out of time too many times. The match ends in a **draw**.\n# Draw."
 	challengeAcceptedWhileInGameErrorMessage            = "You're in the middle of a game already."
+	challengeCancelledConfirmation                      = "You have cancelled your challenge."
+	challengeDraftOutdatedErrorMessage                  = "You've tried to change an outdated challenge. Use the `challenge` command to start a new one."
 	challengeRefusedWhileInGameErrorMessage             = "You're in the middle of a game already."
 	challengerIssuesChallengeWhileInSessionErrorMessage = "You're already busy. Try again after your game is done."
 	challengerNotBAGHerErrorMessage                     = "You are not a `bagher`! Use the `/join` command to become a `bagher` and issue challenges."
@@ -25,6 +42,7 @@ const (
 		"- If the `bagher` role exists, make sure that it's lower on the role heirarchy than the BAGH role.\n" +
 		"- The `play-bagh` channel should give the BAGH app the following permissions:\n" +
 		"  - green viewing.\n" +
+		"  - green managing messages, so that spectators can't talk in match threads.\n" +
 		"  - default for everything else."
 	chooseAnActionPrompt          = "Choose one of the following actions."
 	exitMatchPrompt               = "Exit the match by selecting one of the following options."
@@ -33,21 +51,32 @@ const (
 	goodbyeMessage                = "You can no longer play BAGH in this server. Goodbye!"
 	issueChallengePrompt          = "Issue someone a challenge by right-clicking on their name in the server, going to Apps," +
 		" and clicking the `challenge` option with my icon next to it."
+	leaderboardUnavailableErrorMessage     = "Ratings aren't being kept, so there's no leaderboard to show."
+	leaveQueueOutdatedErrorMessage         = "You're not in the queue anymore."
 	leaveWhenInSessionErrorMessage         = "You can't leave BAGH while you're in a game session. `refuse`, `rescind`, or `forfeit` to enable leaving."
+	matchRestoredNotification              = "BAGH was restarted. The match picks up where it left off."
 	nonPlayerUsesInGameCommandErrorMessage = "You are not a player in this match of BAGH."
 	playBAGHChannelMissingErrorMessage     = "The `play-bagh` channel is missing. Ask an admin to run `/restore` to bring it back."
 	playerNotBAGHerJoinPrompt              = "Use the `/join` command to view the BAGH channel and start playing BAGH."
+	queueJoinedConfirmation                = "You're in the queue for a ranked match. You'll be paired with someone close to your rating, and the longer you wait, the wider the search gets."
+	queueLeftConfirmation                  = "You have left the queue."
 	refuseOutdatedChallengeErrorMessage    = "You've tried to refuse an outdated challenge."
+	replayUnavailableErrorMessage          = "Match history isn't being kept, so there are no matches to replay."
 	resendLastRoundNotification            = "The message for the current round got deleted. It will now be re-sent."
 	rescindOutdatedChallengeErrorMessage   = "You've tried to rescind an outdated challenge."
 	restoreConfirmation                    = "`play-bagh` channel, `bagher` role, and all ongoing match threads have been restored."
 	roleMissingErrorMessage                = "The `bagher` role is missing from the server. Ask an admin to run `/restore` to bring it back."
 	selfAcceptChallengeErrorMessage        = "You can't accept your own challenge!"
 	selfChallengeErrorMessage              = "You can't challenge yourself!"
+	spectatorNotBAGHerErrorMessage         = "You are not a `bagher`! Use the `/join` command to become a `bagher` and watch matches."
+	spectatorUsesInGameCommandErrorMessage = "You're watching this match. Only its players can play it."
+	statsUnavailableErrorMessage           = "Match history isn't being kept, so there are no stats to show."
 	undoneSelectionChooseAnActionPrompt    = "You have undone your selection. " + chooseAnActionPrompt
 	votedToDrawConfirmation                = "You have voted to end the match this round in a draw."
 	voteToDrawPassesNotification           = "By unanimous consent, the match ends this round in a **draw**.\n# Draw."
 	voteToDrawWithdrawnConfirmation        = "You have withdrawn your vote to end the match this round in a draw."
+	watchFinishedMatchErrorMessage         = "That match is over."
+	watchThreadMissingErrorMessage         = "That match's thread couldn't be joined. Ask an admin to run `/restore` to bring it back."
 	welcomeMessage                         = "Welcome to BAGH! You can now play in this server."
 )
 
@@ -71,8 +100,31 @@ func challengeIssuedConfirmationToChallenger(challengee *discordgo.User) string
 	return "You have challenged " + challengee.Mention() + "."
 }
 
-func challengeIssuedNotificationToChallengee(challenger *discordgo.User) string {
-	return challenger.Mention() + " has challenged you to a BAGH match."
+func challengeIssuedNotificationToChallengee(challenger *discordgo.User, guild *discordgo.Guild, rules engine.Ruleset) string {
+	where := ""
+	if guild != nil {
+		where = " in **" + guild.Name + "**"
+	}
+	return challenger.Mention() + " has challenged you to a BAGH match" + where + ".\n" + challengeTerms(rules)
+}
+
+func challengeTerms(rules engine.Ruleset) string {
+	games := " games"
+	if rules.GamesToWin == 1 {
+		games = " game"
+	}
+	return "- First to **" + strconv.Itoa(rules.GamesToWin) + "**" + games + "\n" +
+		"- **" + strconv.Itoa(rules.StartingHP) + "** starting HP, overheal up to **" + strconv.Itoa(rules.MaxHP) + "**\n" +
+		"- Boost cap of **" + strconv.Itoa(rules.MaxBoost) + "**\n" +
+		"- Round clock: **" + rules.Clock.Describe() + "**\n"
+}
+
+func challengeTermsPrompt(draft *ChallengeDraft) string {
+	prompt := "Choose the terms of your challenge to " + draft.Challengee.Mention() + ".\n" + challengeTerms(draft.Rules)
+	if draft.IsAgainstBAGH() {
+		prompt += "- Difficulty: **" + draft.AILevel.Title() + "**\n"
+	}
+	return prompt
 }
 
 func challengeRefusedConfirmationToChallengee(challenger *discordgo.User) string {
@@ -91,6 +143,14 @@ func challengeRescindedNotificationToChallengee(challenger *discordgo.User) stri
 	return challenger.Mention() + " has rescinded their challenge."
 }
 
+func challengeExpiredNotificationToChallenger(challengee *discordgo.User) string {
+	return "Your challenge to " + challengee.Mention() + " has expired without an answer."
+}
+
+func challengeExpiredNotificationToChallengee(challenger *discordgo.User) string {
+	return challenger.Mention() + "'s challenge has expired without an answer."
+}
+
 func challengeIssuedWhileChallengeeInSessionErrorMessage(challengee *discordgo.User) string {
 	return challengee.Mention() + " is busy. Try challenging them later."
 }
@@ -108,6 +168,10 @@ func gameThreadTitle(challenger *discordgo.Member, challengee *discordgo.Member)
 	return challenger.DisplayName() + "'s BAGH Match Against " + challengeeNick
 }
 
+func botGameThreadTitle(challenger *discordgo.Member, level ai.Level) string {
+	return gameThreadTitle(challenger, nil) + " (" + level.Title() + ")"
+}
+
 func memberRemovedNotification(removedPlayer *discordgo.User) string {
 	return removedPlayer.Mention() + " has been removed from the server you were playing BAGH in. The session has been terminated."
 }
@@ -117,6 +181,18 @@ func playerAcceptOrRefuseChallengePrompt(challenger *discordgo.User, dm *discord
 		"https://discord.com/channels/@me/" + dm.ID + "/" + message.ID
 }
 
+func playerNotInMatchErrorMessage(player *discordgo.User) string {
+	return player.Mention() + " isn't playing a match right now."
+}
+
+func matchStartedAnnouncement(challenger *discordgo.User, challengee *discordgo.User) string {
+	return "A BAGH match between " + challenger.Mention() + " and " + challengee.Mention() + " has started!"
+}
+
+func spectatingConfirmation(thread *discordgo.Channel) string {
+	return "You're now watching " + thread.Mention() + ". You'll see every round and what was played, but not what either player picks until the round is over."
+}
+
 func playerInGameRedirectToGameThread(thread *discordgo.Channel) string {
 	return "You're in the middle of a BAGH game.\nJoin back in here: " + thread.Mention()
 }
@@ -128,3 +204,126 @@ func votedToDrawNotification(voter *discordgo.User) string {
 func voteToDrawWithdrawnNotification(voter *discordgo.User) string {
 	return voter.Mention() + " has withdrawn their vote to end the game this round in a draw."
 }
+
+func percentage(fraction float64) string {
+	return strconv.Itoa(int(math.Round(fraction*100))) + "%"
+}
+
+func playerStatsMessage(user *discordgo.User, stats PlayerStats) string {
+	if stats.Matches() == 0 {
+		return user.Mention() + " hasn't finished a BAGH match in this server yet."
+	}
+
+	message := "## BAGH stats for " + user.Mention() + "\n" +
+		"- Matches: **" + strconv.Itoa(stats.MatchesWon) + "** won, **" + strconv.Itoa(stats.MatchesLost) + "** lost, **" +
+		strconv.Itoa(stats.MatchesDrawn) + "** drawn\n" +
+		"- Forfeits: **" + strconv.Itoa(stats.Forfeits) + "**\n" +
+		"- Games: **" + strconv.Itoa(stats.GamesWon) + "** won, **" + strconv.Itoa(stats.GamesLost) + "** lost, **" +
+		strconv.Itoa(stats.GamesDrawn) + "** drawn\n"
+
+	if actions := stats.Actions(); actions > 0 {
+		message += "- Actions:"
+		for _, action := range []Action{Boost, Attack, Guard, Heal} {
+			message += " " + actionStrings[action] + " " + percentage(float64(stats.ActionCounts[action])/float64(actions))
+		}
+		message += "\n"
+	}
+
+	if stats.Attacks > 0 {
+		message += "- Attacks landed: **" + percentage(stats.AttackSuccessRate()) + "** (" +
+			strconv.Itoa(stats.AttacksLanded) + " of " + strconv.Itoa(stats.Attacks) + ")\n" +
+			"- Average boost before attacking: **" + strconv.FormatFloat(stats.AverageBoostBeforeAttacking(), 'f', 1, 64) + "**\n"
+	}
+
+	return message
+}
+
+func leaderboardMessage(standings []Standing, page int, pages int) string {
+	if len(standings) == 0 {
+		return "Nobody in this server has finished a ranked BAGH match yet."
+	}
+
+	message := "## BAGH Leaderboard\n"
+	start := page * leaderboardPageSize
+	end := min(start+leaderboardPageSize, len(standings))
+	for place := start; place < end; place++ {
+		standing := standings[place]
+		matches := " matches"
+		if standing.Rating.Matches == 1 {
+			matches = " match"
+		}
+		message += strconv.Itoa(place+1) + ". <@" + standing.UserID + "> **" + strconv.Itoa(int(math.Round(standing.Rating.Value))) + "**"
+		if standing.Rating.Deviation > 0 {
+			message += " ± " + strconv.Itoa(int(math.Round(standing.Rating.Deviation)))
+		}
+		message += " (" + strconv.Itoa(standing.Rating.Matches) + matches + ")\n"
+	}
+	message += "-# Page " + strconv.Itoa(page+1) + " of " + strconv.Itoa(pages)
+	return message
+}
+
+func queuedMatchFoundNotification(opponent *discordgo.User, thread *discordgo.Channel) string {
+	return "You've been paired with " + opponent.Mention() + " for a ranked match!\nPlay here: " + thread.Mention()
+}
+
+func mentions(users []*discordgo.User) string {
+	mentions := ""
+	for i, user := range users {
+		if i > 0 {
+			mentions += " and "
+		}
+		mentions += user.Mention()
+	}
+	return mentions
+}
+
+func roundClockWarning(users []*discordgo.User, remaining time.Duration) string {
+	return "⏰ " + mentions(users) + ", you have **" + engine.FormatDuration(remaining) + "** left to choose an action this round."
+}
+
+func roundClockRanOutNotification(users []*discordgo.User, policy engine.TimeoutPolicy) string {
+	penalty := "guards"
+	if len(users) > 1 {
+		penalty = "guard"
+	}
+	if policy == engine.TimeoutForfeitRound {
+		penalty = "forfeits the round"
+		if len(users) > 1 {
+			penalty = "forfeit the round"
+		}
+	}
+	return "⏰ Time's up! " + mentions(users) + " didn't choose an action in time, and " + penalty + "."
+}
+
+func outOfTimeoutsNotification(user *discordgo.User) string {
+	return "⏰ Time's up! " + user.Mention() + " has run out of time too many times, and forfeits the match."
+}
+
+func matchRecapMessage(matchID string) string {
+	message := "## Highlights"
+	if matchID != "" {
+		message += "\n-# Match ID: `" + matchID + "`. Step through it with `/replay " + matchID + "`."
+	}
+	return message
+}
+
+func replayNotFoundErrorMessage(matchID string) string {
+	return "There's no finished match in this server with the ID `" + matchID + "`."
+}
+
+func replayStepMessage(match *ArchivedMatch, step ReplayStep, index int, steps int) string {
+	names := [2]string{"<@" + match.Players[0].ID + ">", "<@" + match.Players[1].ID + ">"}
+	message := "## Replay of " + names[0] + " vs " + names[1] + "\n" +
+		"-# Match `" + match.ID + "`, step " + strconv.Itoa(index+1) + " of " + strconv.Itoa(steps) + "\n"
+	if len(step.Events) > 0 {
+		message += engine.RenderMarkdown(step.Events, names) + "\n"
+	}
+	if isMatchOver, _ := step.State.IsMatchOver(); !isMatchOver {
+		message += step.State.ToString(names)
+	}
+	return message
+}
+
+func matchExportedConfirmation(matchID string) string {
+	return "Here's match `" + matchID + "` in BAGH notation."
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"hwacha/bagh/board"
+	"hwacha/bagh/engine"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// accents telling the challenger and challengee apart
+var playerAccents = [2]string{"🔵", "🔴"}
+
+const roundEmbedColor = 9859481 // light purple, like the bagher role
+
+// fills count of width pips, like `███░░`
+func pipBar(count int, width int) string {
+	count = max(0, min(count, width))
+	return "`" + strings.Repeat("█", count) + strings.Repeat("░", width-count) + "`"
+}
+
+// ToEmbed renders the round as an embed with a field per player.
+// ToString renders the same in Markdown, for where embeds can't be sent.
+func (game *MatchOngoing) ToEmbed() *discordgo.MessageEmbed {
+	state := game.State
+	rules := state.Rules
+	itoa := strconv.Itoa
+
+	fields := make([]*discordgo.MessageEmbedField, 0, 2)
+	for i, player := range game.GetPlayers() {
+		p := state.Players[i]
+
+		priority := "none"
+		if p.Priority > 0 {
+			priority = "x" + itoa(p.Priority)
+		}
+		shield := "intact"
+		if p.ShieldBreakCounter > 0 {
+			odds := rules.MendOdds(p.ShieldBreakCounter)
+			shield = "❌ broken (1 in " + itoa(odds) + " chance of mending, " + percentage(1/float64(odds)) + ")"
+		}
+
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name: playerAccents[i] + " " + player.User.Username,
+			Value: player.User.Mention() + "\n" +
+				"❤️ " + pipBar(p.HP, rules.MaxHP) + " " + itoa(p.HP) + "/" + itoa(rules.MaxHP) + "\n" +
+				"⬆️ " + pipBar(p.Boost, rules.MaxBoost) + " " + itoa(p.Boost) + "/" + itoa(rules.MaxBoost) + "\n" +
+				"⏩ Priority: " + priority + "\n" +
+				"🛡️ Shield: " + shield,
+			Inline: true,
+		})
+	}
+
+	footer := "Score: " + itoa(state.Players[0].Wins) + " – " + itoa(state.Players[1].Wins) +
+		" · first to " + itoa(rules.GamesToWin)
+	if game.IsAgainstBAGH() {
+		footer += " · " + game.AILevel.Title() + " difficulty"
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:  "Game " + itoa(state.Game) + " · Round " + itoa(state.Round),
+		Color:  roundEmbedColor,
+		Fields: fields,
+		Footer: &discordgo.MessageEmbedFooter{Text: footer},
+	}
+}
+
+const roundImageName = "round.png"
+
+// pictures the state as a PNG to attach to a message.
+// There's nothing to attach if it couldn't be drawn.
+func roundImageFiles(state engine.State) []*discordgo.File {
+	var image bytes.Buffer
+	if err := board.EncodePNG(&image, state); err != nil {
+		fmt.Println("error drawing round: ", err)
+		return nil
+	}
+	return []*discordgo.File{{Name: roundImageName, ContentType: "image/png", Reader: &image}}
+}
+
+// posts an animated recap of the finished match to its thread, if any rounds were played,
+// with its ID if it was archived. The caller must hold the match's lock.
+func postRecap(s *discordgo.Session, game *MatchOngoing, archived *ArchivedMatch) {
+	if len(game.Rounds) == 0 {
+		return
+	}
+	var recap bytes.Buffer
+	if err := board.EncodeRecap(&recap, game.State.Rules, game.Rounds); err != nil {
+		fmt.Println("error drawing recap: ", err)
+		return
+	}
+	matchID := ""
+	if archived != nil {
+		matchID = archived.ID
+	}
+	s.ChannelMessageSendComplex(game.Thread.ID, &discordgo.MessageSend{
+		Content: matchRecapMessage(matchID),
+		Files:   []*discordgo.File{{Name: "recap.gif", ContentType: "image/gif", Reader: &recap}},
+	})
+}
+
+// sends the round with the buttons to play it, under header. It's sent as an embed,
+// or in Markdown if the embed can't be, like when BAGH isn't allowed to embed links.
+// Either way, a picture of the round is attached.
+// The players are mentioned outside the embed, which adds them to the match's thread.
+func sendRoundMessage(s *discordgo.Session, channelID string, game *MatchOngoing, header string) (*discordgo.Message, error) {
+	names := game.names()
+	embed := game.ToEmbed()
+	files := roundImageFiles(game.State)
+	if len(files) > 0 {
+		embed.Image = &discordgo.MessageEmbedImage{URL: "attachment://" + roundImageName}
+	}
+	msg, err := s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Content:    header + "🤺 " + names[0] + " vs " + names[1],
+		Embeds:     []*discordgo.MessageEmbed{embed},
+		Components: chooseActionOrExitGameButtonRow,
+		Files:      files,
+	})
+	if err == nil {
+		return msg, nil
+	}
+	// the attempt used up the picture, so draw it again
+	return s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Content:    header + game.ToString(),
+		Components: chooseActionOrExitGameButtonRow,
+		Files:      roundImageFiles(game.State),
+	})
+}
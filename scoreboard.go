@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"hwacha/bagh/engine"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// colours of the scoreboard while the match is on, and once it's over
+const (
+	scoreboardLiveColor     = 0x57f287
+	scoreboardFinishedColor = 0x969696
+)
+
+// the live scoreboard kept in play-bagh for the match.
+// result is empty while the match is on.
+func scoreboardEmbed(game *MatchOngoing, result string) *discordgo.MessageEmbed {
+	state := game.State
+	players := game.GetPlayers()
+
+	embed := &discordgo.MessageEmbed{
+		Title:       players[0].User.Username + " vs " + players[1].User.Username,
+		Description: players[0].User.Mention() + " vs " + players[1].User.Mention(),
+		Color:       scoreboardLiveColor,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Game", Value: strconv.Itoa(state.Game), Inline: true},
+			{Name: "Round", Value: strconv.Itoa(state.Round), Inline: true},
+			{
+				Name:   "Score",
+				Value:  strconv.Itoa(state.Players[0].Wins) + " – " + strconv.Itoa(state.Players[1].Wins),
+				Inline: true,
+			},
+		},
+		Footer: &discordgo.MessageEmbedFooter{Text: state.Rules.Describe()},
+	}
+	if game.IsAgainstBAGH() {
+		embed.Description += " (" + game.AILevel.Title() + ")"
+	}
+
+	if result != "" {
+		embed.Description += "\n" + result
+		embed.Color = scoreboardFinishedColor
+		// the game and round are where it left off, so only the score matters now
+		embed.Fields = embed.Fields[2:]
+	}
+	return embed
+}
+
+// posts the match's scoreboard, which anyone in the channel can use to watch it.
+// The caller must hold the match's lock.
+func postScoreboard(s *discordgo.Session, ch *discordgo.Channel, game *MatchOngoing) {
+	msg, err := s.ChannelMessageSendComplex(ch.ID, &discordgo.MessageSend{
+		Content:    matchStartedAnnouncement(game.Challenger.User, game.Challengee.User),
+		Embeds:     []*discordgo.MessageEmbed{scoreboardEmbed(game, "")},
+		Components: watchMatchButtonRow(game),
+	})
+	if err != nil {
+		fmt.Println("error posting scoreboard: ", err)
+		return
+	}
+	game.Scoreboard = msg
+}
+
+// brings the scoreboard up to date, along with its Watch button.
+// The caller must hold the match's lock.
+func updateScoreboard(s *discordgo.Session, game *MatchOngoing) {
+	if game.Scoreboard == nil {
+		return
+	}
+	components := watchMatchButtonRow(game)
+	s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		ID:         game.Scoreboard.ID,
+		Channel:    game.Scoreboard.ChannelID,
+		Embeds:     &[]*discordgo.MessageEmbed{scoreboardEmbed(game, "")},
+		Components: &components,
+	})
+}
+
+// shows how the match ended on its scoreboard, and takes away the Watch button.
+// The caller must hold the match's lock.
+func finishScoreboard(s *discordgo.Session, game *MatchOngoing, outcome Outcome, winner int) {
+	if game.Scoreboard == nil {
+		return
+	}
+
+	players := game.GetPlayers()
+	result := ""
+	switch outcome {
+	case OutcomeWin:
+		result = "🏆 " + players[winner].User.Mention() + " **wins**!"
+	case OutcomeDraw:
+		result = "The match ended in a **draw**."
+	case OutcomeDrawByVote:
+		result = "The players agreed to a **draw**."
+	case OutcomeForfeit:
+		if winner == engine.NoWinner {
+			result = "Both players ran out of time. The match ended in a **draw**."
+		} else {
+			result = players[1-winner].User.Mention() + " forfeited. 🏆 " + players[winner].User.Mention() + " **wins**!"
+		}
+	case OutcomeMemberRemoved:
+		result = players[1-winner].User.Mention() + " left the server, so the match was called off."
+	}
+
+	s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		ID:         game.Scoreboard.ID,
+		Channel:    game.Scoreboard.ChannelID,
+		Embeds:     &[]*discordgo.MessageEmbed{scoreboardEmbed(game, result)},
+		Components: &emptyActionGrid,
+	})
+}
@@ -2,38 +2,109 @@ package main
 
 import (
 	"math/rand/v2"
-	"strconv"
+	"slices"
+	"sync"
+	"time"
+
+	"hwacha/bagh/ai"
+	"hwacha/bagh/engine"
 
 	"github.com/bwmarrin/discordgo"
 )
 
 type SessionState interface {
 	isSessionState()
+	Lock()
+	Unlock()
 }
 
 type AwaitingChallengeResponse struct {
+	sync.Mutex
+
 	Challenger *discordgo.User
 	Challengee *discordgo.User
 
 	Channel *discordgo.Channel
+	Rules   engine.Ruleset
 
 	ChallengerInteractions []*discordgo.Interaction
 	ChallengeeMessage      *discordgo.Message
+	Issued                 time.Time
 }
 
 func (a *AwaitingChallengeResponse) isSessionState() {}
 
+// the terms of a challenge that the challenger hasn't sent yet
+type ChallengeDraft struct {
+	Challengee *discordgo.User
+	Channel    *discordgo.Channel
+	Rules      engine.Ruleset
+	AILevel    ai.Level
+}
+
+func (draft *ChallengeDraft) IsAgainstBAGH() bool {
+	return draft.Challengee.ID == ApplicationID
+}
+
+// changes the draft's ruleset, keeping its round clock
+func (draft *ChallengeDraft) setTerms(gamesToWin int, startingHP int, maxBoost int) {
+	clock := draft.Rules.Clock
+	draft.Rules = engine.CustomRuleset(gamesToWin, startingHP, maxBoost)
+	draft.Rules.Clock = clock
+}
+
 type MatchOngoing struct {
+	sync.Mutex
+
 	Thread             *discordgo.Channel
 	LastRoundMessageID string
 	Challenger         Player
 	Challengee         Player
-	Game               int
-	Round              int
+	State              engine.State
+	Seed               uint64
+	AILevel            ai.Level
+	Started            time.Time
+	Rounds             []engine.RoundRecord
+	Timeouts           [2]int
+	Spectators         []string
+	Scoreboard         *discordgo.Message
+	rng                *rand.Rand
+	aiRNG              *rand.Rand
+
+	// kept so that the match can be saved and picked back up mid-stream
+	rngSource   *rand.PCG
+	aiRNGSource *rand.PCG
+
+	// the round clock's pending warnings and timeout, and which round they're for
+	clockTimers []*time.Timer
+	clockRound  int
 }
 
 func (o *MatchOngoing) isSessionState() {}
 
+// shield rolls and AI picks draw from separate streams of the seed,
+// so that replaying a match's actions reproduces its shield rolls
+func NewMatchOngoing(thread *discordgo.Channel, challenger *discordgo.User, challengee *discordgo.User, rules engine.Ruleset, seed uint64) *MatchOngoing {
+	game := &MatchOngoing{
+		Thread:             thread,
+		LastRoundMessageID: "",
+		Challenger:         NewPlayer(challenger),
+		Challengee:         NewPlayer(challengee),
+		State:              engine.NewState(rules),
+		Seed:               seed,
+		Started:            time.Now(),
+	}
+	game.useSources(engine.NewSource(seed), rand.NewPCG(seed, 1))
+	return game
+}
+
+func (game *MatchOngoing) useSources(rngSource *rand.PCG, aiRNGSource *rand.PCG) {
+	game.rngSource = rngSource
+	game.aiRNGSource = aiRNGSource
+	game.rng = rand.New(rngSource)
+	game.aiRNG = rand.New(aiRNGSource)
+}
+
 func (game *MatchOngoing) GetPlayer(userID string) *Player {
 	if game.Challenger.User.ID == userID {
 		return &game.Challenger
@@ -54,385 +125,102 @@ func (game *MatchOngoing) GetOtherPlayer(userID string) *Player {
 	return nil
 }
 
+// the player's index in the match's state, challenger first
+func (game *MatchOngoing) playerIndex(userID string) int {
+	if game.Challengee.User.ID == userID {
+		return 1
+	}
+	return 0
+}
+
+func (game *MatchOngoing) IsSpectator(userID string) bool {
+	return slices.Contains(game.Spectators, userID)
+}
+
 func (game *MatchOngoing) GetPlayers() [2]*Player {
 	return [2]*Player{&game.Challenger, &game.Challengee}
 }
 
 func (game *MatchOngoing) ChooseAIMove() {
-	r := rand.IntN(4)
-	game.Challengee.currentAction = Action(r)
+	game.Challengee.currentAction = ai.ChooseAt(game.AILevel, game.State, 1, game.aiRNG)
 }
 
-// returns whether the game ended, if it was a draw,
-// and if not, who the winner and loser was
-func (game *MatchOngoing) IsGameOver() (bool, *Player) {
-	if game.Challenger.HP > 0 && game.Challengee.HP > 0 {
-		return false, nil
-	}
-	if game.Challenger.HP > game.Challengee.HP {
-		return true, &game.Challenger
-	}
-	if game.Challengee.HP > game.Challenger.HP {
-		return true, &game.Challengee
-	}
-
-	// if both player have no health and both have the same HP, draw.
-	return true, nil
+func (game *MatchOngoing) names() [2]string {
+	return [2]string{game.Challenger.User.Mention(), game.Challengee.User.Mention()}
 }
 
-func (game *MatchOngoing) IsMatchOver() (bool, *Player) {
-	if game.Challenger.Wins >= GAMES_TO_WIN && game.Challengee.Wins < GAMES_TO_WIN {
-		return true, &game.Challenger
-	}
-	if game.Challengee.Wins >= GAMES_TO_WIN && game.Challenger.Wins < GAMES_TO_WIN {
-		return true, &game.Challengee
+// Choose sets the player's action for the round, and plays the round if the
+// other player has already chosen theirs, locking both in. It reports whether
+// it played the round, and if so returns the same as NextStateFromActions.
+// The caller must hold the match's lock.
+func (game *MatchOngoing) Choose(userID string, action Action) (bool, string, bool, *Player) {
+	actor := game.GetPlayer(userID)
+	actor.SetAction(action)
+	if game.Challenger.GetAction() == Unchosen || game.Challengee.GetAction() == Unchosen || actor.actionLocked {
+		return false, "", false, nil
 	}
-	if game.Challenger.Wins >= GAMES_TO_WIN && game.Challengee.Wins >= GAMES_TO_WIN {
-		return true, nil
+
+	for _, player := range game.GetPlayers() {
+		player.actionLocked = true
 	}
-	return false, nil
+	actionLog, isMatchOver, winner := game.NextStateFromActions()
+	return true, actionLog, isMatchOver, winner
 }
 
-const (
-	BASE_MAX_HEALTH int = 3
-	MAX_BOOST       int = 6
-	GAMES_TO_WIN    int = 3
-)
-
+// resolves the chosen actions, returning the action log,
+// whether the match ended, and if so, who won it.
+// Both players' actions are cleared for the next round.
 func (game *MatchOngoing) NextStateFromActions() (string, bool, *Player) {
-	gainedOrRetainedPriority := make(map[*Player]bool)
-	shieldJustBroke := make(map[*Player]bool)
+	players := game.GetPlayers()
+	actions := [2]Action{players[0].GetAction(), players[1].GetAction()}
+	mended := engine.RollMends(game.State, game.rng)
+	return game.playRound(engine.RoundRecord{Actions: actions, Mended: mended})
+}
 
-	players := [2]*Player{&game.Challenger, &game.Challengee}
+func (game *MatchOngoing) playRound(round engine.RoundRecord) (string, bool, *Player) {
+	players := game.GetPlayers()
 
-	actionLog := ""
+	previousGame := game.State.Game
+	var events []engine.Event
+	game.State, events = engine.ResolveRolled(game.State, round.Actions, round.Mended)
+	round.State = game.State
+	game.Rounds = append(game.Rounds, round)
+	actionLog := engine.RenderMarkdown(events, game.names())
 
-	// Initial Phase
 	for _, player := range players {
-		playerAction := player.GetAction()
-		playerMention := player.User.Mention()
-
-		if player.ShieldBreakCounter > 0 {
-			roll := rand.Float32()
-			if roll < 1.0/float32(player.ShieldBreakCounter+1) {
-				player.ShieldBreakCounter = 0
-			}
-
-			if player.ShieldBreakCounter == 0 {
-				actionLog += "- " + playerMention + "'s shield is **mended**!\n"
-			} else {
-				actionLog += "- " + playerMention + "'s shield remains **broken**.\n"
-			}
-		}
-
-		if playerAction == Boost {
-			if player.Boost < MAX_BOOST {
-				player.Boost += 1
-				actionLog += "- " + playerMention + " " + actionStrings[Boost] + "s to **" + strconv.Itoa(player.Boost) + "**.\n"
-			} else {
-				actionLog += "- " + playerMention + " " + actionStrings[Boost] + "s, preserving a boost of **" + strconv.Itoa(player.Boost) + "**.\n"
-			}
-		}
-	}
-
-	type ActionInfo struct {
-		Agent   *Player
-		Patient *Player
-	}
-
-	playerRelations := [2]ActionInfo{
-		{
-			Agent:   &game.Challenger,
-			Patient: &game.Challengee,
-		},
-		{
-			Agent:   &game.Challengee,
-			Patient: &game.Challenger,
-		},
-	}
-
-	delayString := ""
-
-	// Middle Phase
-	for _, playerRelation := range playerRelations {
-		agent := playerRelation.Agent
-		patient := playerRelation.Patient
-
-		agentAction := agent.GetAction()
-		patientAction := patient.GetAction()
-
-		agentMention := agent.User.Mention()
-		patientMention := patient.User.Mention()
-
-		agentHasPriority := agent.Priority > patient.Priority
-		patientHasPriority := patient.Priority > agent.Priority
-
-		// positive if agent has more boost
-		// negative if patient has more boost
-		// 0 if equal boost
-		boostDifferential := agent.Boost - patient.Boost
-
-		switch agentAction {
-		case Attack:
-			attackGoesThrough := true
-			switch patientAction {
-			case Attack:
-				if patientHasPriority { // attack has no effect
-					attackGoesThrough = false
-
-					attackString := actionStrings[Attack]
-					if agent.Boost > 0 {
-						attackString = "boosted " + attackString
-					}
-					delayString += "- " + patientMention + "'s counterattack renders " + agentMention + "'s " + attackString + " **impotent**.\n"
-				}
-			case Guard:
-				if patient.ShieldBreakCounter > 0 { // shield is broken
-					actionLog += "- " + agentMention + " attacks, and " + patientMention + " " + actionStrings[Guard] + "s, but the shield is **broken**.\n"
-				} else { // shield not broken
-					attackGoesThrough = false
-					attackString := actionStrings[Attack] + "s"
-					if agent.Boost > 0 {
-						attackString += " with a boost of " + strconv.Itoa(agent.Boost)
-					}
-					guardString := actionStrings[Guard] + "s"
-					if patient.Boost > 0 {
-						guardString += " with a boost of " + strconv.Itoa(patient.Boost)
-					}
-					actionLog += "- " + agentMention + " " + attackString + ", but " + patientMention + " " + guardString + " and **prevents damage**.\n"
-					// agent has higher boost
-					if boostDifferential > 0 {
-						patient.ShieldBreakCounter = boostDifferential
-						shieldJustBroke[patient] = true
-						actionLog += "- " + patientMention + "'s shield **breaks**! Its damage is at " + strconv.Itoa(patient.ShieldBreakCounter) + ".\n"
-					} else {
-						oldPriority := patient.Priority
-						totalPriorityGain := 1 // base gain from effective guard
-
-						priorityIsDampened := agent.Priority > 0
-						if priorityIsDampened {
-							// agent's priority dampens priority gain by 1,
-							// which can happen for N potential turns,
-							// preserving payoff equivalence
-							totalPriorityGain -= 1
-						}
-						totalPriorityGain += -boostDifferential
-						patient.Priority += max(0, totalPriorityGain)
-						// patient gains or retains priority
-
-						if oldPriority == patient.Priority {
-							actionLog += "- Because of " + agentMention + "'s priority, " + patientMention + " gains no priority.\n"
-						} else {
-							// account for overcounted priority w/ depreciation
-							// now instead of later, for the sake of log coherence
-							if oldPriority > 0 {
-								patient.Priority -= 1
-							}
-
-							extraPriorityIsPositive := boostDifferential < 0
-							priorityIsRetained := oldPriority == patient.Priority
-
-							actionLog += "-" + patientMention
-							if priorityIsRetained {
-								actionLog += " retains priority"
-							} else {
-								actionLog += " gains priority"
-							}
-
-							if extraPriorityIsPositive {
-								actionLog += " boosted by " + strconv.Itoa(-boostDifferential)
-
-								if priorityIsDampened {
-									actionLog += " but"
-								}
-							}
-
-							if priorityIsDampened {
-								actionLog += " dampened by 1 by " + agentMention + "'s priority"
-							}
-
-							if priorityIsRetained {
-								actionLog += " at **"
-							} else {
-								actionLog += " up to **"
-							}
-
-							actionLog += strconv.Itoa(patient.Priority) + "**.\n"
-							gainedOrRetainedPriority[patient] = true
-						}
-					}
-				}
-			case Heal:
-				if !patientHasPriority {
-					// heal is interrupted
-					delayString += "- " + patientMention + "'s " + actionStrings[Heal] + "ing is **interrupted** by " + agentMention + "'s attack.\n"
-				}
-
-			}
-			if attackGoesThrough {
-				damage := 1 + agent.Boost
-
-				patient.HP -= damage
-				patient.HP = max(patient.HP, 0)
-
-				actionLog += "- " + agentMention + " " + actionStrings[Attack] + "s for "
-				if agent.Boost > 0 {
-					actionLog += "a boosted "
-				}
-				actionLog += "**" + strconv.Itoa(damage) + "** damage"
-				if agentHasPriority {
-					actionLog += " with priority"
-				}
-
-				actionLog += ".\n"
-			}
-		case Guard:
-			if patientAction != Attack {
-				// no effect
-				actionLog += "- " + agentMention + " " + actionStrings[Guard] + "s to **no effect**.\n"
-			}
-		case Heal:
-			if patientAction != Attack || agentHasPriority { // heal not interrupted
-				maxOverheal := BASE_MAX_HEALTH + 1 + MAX_BOOST
-				newHP := min(agent.HP+1+agent.Boost, maxOverheal)
-
-				actionLog += "- " + agentMention + " " + actionStrings[Heal] + "s"
-
-				if patientAction == Attack && agentHasPriority {
-					actionLog += ", with **priority preventing interruption** from " + patient.User.Mention() + "'s attack,"
-				}
-
-				if agent.HP >= newHP { // no effect
-					actionLog += " to no effect.\n"
-				} else {
-					diff := newHP - agent.HP
-					agent.HP = newHP
-
-					actionLog += " by **" + strconv.Itoa(diff) + "** to "
-
-					if newHP > BASE_MAX_HEALTH {
-						actionLog += "an overheal of "
-					}
-
-					actionLog += "**" + strconv.Itoa(newHP) + "**.\n"
-				}
-			}
-		}
+		player.ClearAction()
+		player.UnlockAction()
 	}
 
-	actionLog += delayString
-
-	// determine end game
-	isGameOver, gameWinner := game.IsGameOver()
-
-	secondString := ""
-	thirdString := ""
-
-	// End Phase
-	for _, player := range players {
-		playerAction := player.GetAction()
-		playerMention := player.User.Mention()
-		if playerAction != Boost {
-			if player.Boost > 0 {
-				player.Boost = 0
-				if !isGameOver {
-					actionLog += "- " + playerMention + "'s boost is **expended to 0**.\n"
-				}
-			}
-		}
-
-		if !isGameOver && !gainedOrRetainedPriority[player] && player.Priority > 0 {
-			player.Priority--
-			secondString += "- " + playerMention + "'s priority **falls to " + strconv.Itoa(player.Priority) + "**.\n"
-		}
-
-		if !isGameOver && player.ShieldBreakCounter > 0 {
-			if !shieldJustBroke[player] {
-				player.ShieldBreakCounter--
-			}
-			if player.ShieldBreakCounter == 0 {
-				thirdString += "- " + playerMention + "'s shield is **mended**! "
-			} else {
-				thirdString += "- The chance of " + playerMention + "'s shield mending next turn is **1 in " + strconv.Itoa(player.ShieldBreakCounter+1) + "**.\n"
-			}
-		}
-	}
-	actionLog += secondString
-	actionLog += thirdString
-
-	if isGameOver {
-		if gameWinner == nil {
-			actionLog += "- Both players have lost all health in the same turn, resulting in a **draw**."
-		} else {
-			actionLog += "- " + gameWinner.User.Mention() + " secures **victory**!"
+	isMatchOver, matchWinner := game.State.IsMatchOver()
+	if isMatchOver {
+		if matchWinner == engine.NoWinner {
+			return actionLog, true, nil
 		}
-	} else {
-		game.Round++
+		return actionLog, true, players[matchWinner]
 	}
 
-	isMatchOver := false
-	var matchWinner *Player = nil
-
-	if isGameOver {
-		if gameWinner != nil {
-			gameWinner.Wins += 1
-		}
-		actionLog += "\n- The score is | " +
-			game.Challenger.User.Mention() + " **" + strconv.Itoa(game.Challenger.Wins) + "** | " +
-			game.Challengee.User.Mention() + " **" + strconv.Itoa(game.Challengee.Wins) + "** |\n"
-		isMatchOver, matchWinner = game.IsMatchOver()
-
-		if isMatchOver {
-			actionLog += "- The match has ended."
-		} else {
-			game.Game++
-
-			game.Round = 1
-			for _, player := range players {
-				player.HP = 3
-				player.Boost = 0
-				player.Priority = 0
-				player.ShieldBreakCounter = 0
-				player.currentAction = Unchosen
-				player.actionLocked = false
-				player.votedToDraw = false
-			}
-
-			actionLog += game.GameNumberString()
+	if game.State.Game != previousGame {
+		for _, player := range players {
+			player.votedToDraw = false
 		}
 	}
 
-	return actionLog, isMatchOver, matchWinner
+	return actionLog, false, nil
 }
 
 func (game *MatchOngoing) GameNumberString() string {
-	return "# Game " + strconv.Itoa(game.Game) + "\n"
+	return game.State.GameNumberString()
+}
+
+func (game *MatchOngoing) IsAgainstBAGH() bool {
+	return game.Challengee.User.ID == ApplicationID
 }
 
 func (game *MatchOngoing) ToString() string {
-	gameString := "## Round " + strconv.Itoa(game.Round) + "\n"
-	for _, player := range [2]Player{game.Challenger, game.Challengee} {
-		shield := ""
-		if player.ShieldBreakCounter > 0 {
-			shield += "- 🛡️❌ (chance of mending: 1 in " + strconv.Itoa(player.ShieldBreakCounter+1) + ")\n"
-		}
-		boost := ""
-		if player.Boost > 0 {
-			boost = "- ⬆️"
-			if player.Boost > 1 {
-				boost += "x" + strconv.Itoa(player.Boost)
-			}
-			boost += "\n"
-		}
-		priority := ""
-		if player.Priority > 0 {
-			priority = "- [Priority"
-			if player.Priority > 1 {
-				priority += "x" + strconv.Itoa(player.Priority)
-			}
-			priority += "]\n"
-		}
-		gameString += "🤺 " + player.User.Mention() + "\n- ❤️x" + strconv.Itoa(player.HP) + "\n" + shield + boost + priority + "\n"
+	gameString := game.State.ToString(game.names())
+	if game.IsAgainstBAGH() {
+		gameString += "🤖 Difficulty: **" + game.AILevel.Title() + "**\n"
 	}
 	return gameString
 }
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// SessionManager tracks which session every user is in, per guild,
+// so one user can be in separate sessions in separate guilds.
+// discordgo runs each handler on its own goroutine, so every read and
+// write of a session goes through here. Sessions have their own locks,
+// which are only ever taken without the manager's lock held.
+// If it has a store, sessions are deleted from it as they're removed.
+type SessionManager struct {
+	mu       sync.Mutex
+	sessions map[string]map[string]SessionState
+	drafts   map[draftKey]*ChallengeDraft
+	// matches by the ID of the thread they're played in
+	threads map[string]*MatchOngoing
+	store   *SessionStore
+}
+
+type draftKey struct {
+	GuildID string
+	UserID  string
+}
+
+func NewSessionManager() *SessionManager {
+	return &SessionManager{
+		sessions: make(map[string]map[string]SessionState),
+		drafts:   make(map[draftKey]*ChallengeDraft),
+		threads:  make(map[string]*MatchOngoing),
+	}
+}
+
+func (m *SessionManager) UseStore(store *SessionStore) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.store = store
+}
+
+// Save stores the session if it's still in the guild.
+// The caller must hold the session's lock.
+func (m *SessionManager) Save(guildID string, session SessionState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.store == nil || !m.contains(guildID, session) {
+		return
+	}
+	if err := m.store.Save(guildID, session); err != nil {
+		fmt.Println("error saving session: ", err)
+	}
+}
+
+// SetThread moves the match to the thread, so LockMatchInThread finds it there.
+// The caller must hold the match's lock.
+func (m *SessionManager) SetThread(game *MatchOngoing, thread *discordgo.Channel) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if game.Thread != nil && m.threads[game.Thread.ID] == game {
+		delete(m.threads, game.Thread.ID)
+	}
+	game.Thread = thread
+	m.threads[thread.ID] = game
+}
+
+// LockMatchInThread locks the guild's match played in the thread.
+// Only that match's lock is taken, so it's cheap for channels that aren't match threads.
+func (m *SessionManager) LockMatchInThread(guildID string, threadID string) (*MatchOngoing, bool) {
+	m.mu.Lock()
+	game, found := m.threads[threadID]
+	m.mu.Unlock()
+	if !found {
+		return nil, false
+	}
+
+	game.Lock()
+	if game.Thread != nil && game.Thread.ID == threadID && m.Holds(guildID, game) {
+		return game, true
+	}
+	game.Unlock()
+	return nil, false
+}
+
+// Holds reports whether anyone in the guild is still in session.
+func (m *SessionManager) Holds(guildID string, session SessionState) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.contains(guildID, session)
+}
+
+func (m *SessionManager) contains(guildID string, session SessionState) bool {
+	for _, current := range m.sessions[guildID] {
+		if current == session {
+			return true
+		}
+	}
+	return false
+}
+
+// deletes the session from the store and the thread index once nobody in the guild is in it
+func (m *SessionManager) forget(guildID string, session SessionState) {
+	if m.contains(guildID, session) {
+		return
+	}
+	m.forgetThread(session)
+	if m.store == nil {
+		return
+	}
+	if err := m.store.Delete(guildID, session); err != nil {
+		fmt.Println("error deleting session: ", err)
+	}
+}
+
+func (m *SessionManager) Get(guildID string, userID string) (SessionState, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, found := m.sessions[guildID][userID]
+	return session, found
+}
+
+func (m *SessionManager) Has(guildID string, userID string) bool {
+	_, found := m.Get(guildID, userID)
+	return found
+}
+
+// Lock returns the user's session with its lock held, making sure it's
+// still their session once the lock is acquired. The caller must unlock it.
+func (m *SessionManager) Lock(guildID string, userID string) (SessionState, bool) {
+	for {
+		session, found := m.Get(guildID, userID)
+		if !found {
+			return nil, false
+		}
+
+		session.Lock()
+		current, found := m.Get(guildID, userID)
+		if found && current == session {
+			return session, true
+		}
+		session.Unlock()
+
+		if !found {
+			return nil, false
+		}
+	}
+}
+
+// LockMatch is Lock for users who should be in a match.
+func (m *SessionManager) LockMatch(guildID string, userID string) (*MatchOngoing, bool) {
+	session, found := m.Lock(guildID, userID)
+	if !found {
+		return nil, false
+	}
+	game, isGame := session.(*MatchOngoing)
+	if !isGame {
+		session.Unlock()
+		return nil, false
+	}
+	return game, true
+}
+
+// LockChallenge is Lock for users who should be in a challenge.
+func (m *SessionManager) LockChallenge(guildID string, userID string) (*AwaitingChallengeResponse, bool) {
+	session, found := m.Lock(guildID, userID)
+	if !found {
+		return nil, false
+	}
+	challenge, isChallenge := session.(*AwaitingChallengeResponse)
+	if !isChallenge {
+		session.Unlock()
+		return nil, false
+	}
+	return challenge, true
+}
+
+// LockChallengeByMessage finds the challenge the user was sent in the DM
+// with the given message ID. DMs don't say which guild they're about, so
+// every guild the user has a session in is searched.
+func (m *SessionManager) LockChallengeByMessage(userID string, messageID string) (*AwaitingChallengeResponse, bool) {
+	m.mu.Lock()
+	guildIDs := []string{}
+	for guildID, sessions := range m.sessions {
+		if _, found := sessions[userID]; found {
+			guildIDs = append(guildIDs, guildID)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, guildID := range guildIDs {
+		challenge, isChallenge := m.LockChallenge(guildID, userID)
+		if !isChallenge {
+			continue
+		}
+		if challenge.ChallengeeMessage != nil && challenge.ChallengeeMessage.ID == messageID {
+			return challenge, true
+		}
+		challenge.Unlock()
+	}
+	return nil, false
+}
+
+// Claim puts every user into session, unless any of them is already in one.
+func (m *SessionManager) Claim(guildID string, session SessionState, userIDs ...string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sessions, found := m.sessions[guildID]
+	if !found {
+		sessions = make(map[string]SessionState)
+		m.sessions[guildID] = sessions
+	}
+	for _, userID := range userIDs {
+		if _, found := sessions[userID]; found {
+			return false
+		}
+	}
+	for _, userID := range userIDs {
+		sessions[userID] = session
+	}
+	return true
+}
+
+// Replace moves every user from old to new, as long as they're all still in old.
+func (m *SessionManager) Replace(guildID string, old SessionState, new SessionState, userIDs ...string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sessions := m.sessions[guildID]
+	for _, userID := range userIDs {
+		if sessions[userID] != old {
+			return false
+		}
+	}
+	for _, userID := range userIDs {
+		sessions[userID] = new
+	}
+	return true
+}
+
+// Remove takes every user still in session out of it,
+// reporting whether anyone was.
+func (m *SessionManager) Remove(guildID string, session SessionState, userIDs ...string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sessions := m.sessions[guildID]
+	removed := false
+	for _, userID := range userIDs {
+		if current, found := sessions[userID]; found && current == session {
+			delete(sessions, userID)
+			removed = true
+		}
+	}
+	if len(sessions) == 0 {
+		delete(m.sessions, guildID)
+	}
+	if removed {
+		m.forget(guildID, session)
+	}
+	return removed
+}
+
+// RemoveEveryone takes every user in session out of it.
+func (m *SessionManager) RemoveEveryone(guildID string, session SessionState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sessions := m.sessions[guildID]
+	for userID, current := range sessions {
+		if current == session {
+			delete(sessions, userID)
+		}
+	}
+	if len(sessions) == 0 {
+		delete(m.sessions, guildID)
+	}
+	m.forget(guildID, session)
+}
+
+func (m *SessionManager) forgetThread(session SessionState) {
+	for threadID, game := range m.threads {
+		if game == session {
+			delete(m.threads, threadID)
+		}
+	}
+}
+
+// RemoveGuild forgets every session in the guild and returns them.
+func (m *SessionManager) RemoveGuild(guildID string) []SessionState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	removed := distinctSessions(m.sessions[guildID])
+	delete(m.sessions, guildID)
+	for _, session := range removed {
+		m.forgetThread(session)
+	}
+	if m.store != nil {
+		if err := m.store.DeleteGuild(guildID); err != nil {
+			fmt.Println("error deleting sessions: ", err)
+		}
+	}
+	for key := range m.drafts {
+		if key.GuildID == guildID {
+			delete(m.drafts, key)
+		}
+	}
+	return removed
+}
+
+// InGuild returns every distinct session in the guild at the time of the call.
+func (m *SessionManager) InGuild(guildID string) []SessionState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return distinctSessions(m.sessions[guildID])
+}
+
+func distinctSessions(sessions map[string]SessionState) []SessionState {
+	distinct := []SessionState{}
+	seen := make(map[SessionState]bool)
+	for _, session := range sessions {
+		if !seen[session] {
+			seen[session] = true
+			distinct = append(distinct, session)
+		}
+	}
+	return distinct
+}
+
+func (m *SessionManager) SetDraft(guildID string, userID string, draft *ChallengeDraft) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.drafts[draftKey{guildID, userID}] = draft
+}
+
+// UpdateDraft applies update to the user's draft and returns a copy of the result.
+func (m *SessionManager) UpdateDraft(guildID string, userID string, update func(draft *ChallengeDraft)) (ChallengeDraft, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	draft, found := m.drafts[draftKey{guildID, userID}]
+	if !found {
+		return ChallengeDraft{}, false
+	}
+	update(draft)
+	return *draft, true
+}
+
+// TakeDraft removes the user's draft and returns it.
+func (m *SessionManager) TakeDraft(guildID string, userID string) (*ChallengeDraft, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := draftKey{guildID, userID}
+	draft, found := m.drafts[key]
+	delete(m.drafts, key)
+	return draft, found
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"hwacha/bagh/engine"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// picks the action for the user the way the action buttons do,
+// reporting whether it was the pick that played the round
+func chooseAction(m *SessionManager, guildID string, userID string, action Action) bool {
+	game, found := m.LockMatch(guildID, userID)
+	if !found {
+		return false
+	}
+	defer game.Unlock()
+
+	played, _, _, _ := game.Choose(userID, action)
+	return played
+}
+
+// starts a match between the two users the way accepting a challenge does,
+// racing anyone else trying to accept the same challenge
+func acceptChallenge(m *SessionManager, guildID string, challenge *AwaitingChallengeResponse, threadID string) (*MatchOngoing, bool) {
+	challenge.Lock()
+	defer challenge.Unlock()
+
+	game := NewMatchOngoing(nil, challenge.Challenger, challenge.Challengee, engine.Classic, 1)
+	game.Lock()
+	defer game.Unlock()
+	if !m.Replace(guildID, challenge, game, challenge.Challenger.ID, challenge.Challengee.ID) {
+		return nil, false
+	}
+	m.SetThread(game, &discordgo.Channel{ID: threadID})
+	return game, true
+}
+
+// run with -race, which catches any session touched without its lock held
+func TestSessionManagerResolvesEachRoundOnce(t *testing.T) {
+	const (
+		guilds  = 4
+		matches = 4
+	)
+	m := NewSessionManager()
+
+	var wg sync.WaitGroup
+	for g := range guilds {
+		for n := range matches {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				guildID := "guild" + strconv.Itoa(g)
+				id := strconv.Itoa(n)
+				playMatch(t, m, guildID, "challenger"+id, "challengee"+id, guildID+"thread"+id)
+			}()
+		}
+	}
+	wg.Wait()
+
+	for g := range guilds {
+		if sessions := m.InGuild("guild" + strconv.Itoa(g)); len(sessions) != 0 {
+			t.Errorf("guild %d still has %d sessions", g, len(sessions))
+		}
+	}
+	if len(m.threads) != 0 {
+		t.Errorf("%d threads are still indexed", len(m.threads))
+	}
+}
+
+// plays a match of rounds where both players always pick at the same moment,
+// with bystanders poking at the match as they do, then has both players
+// forfeit at once
+func playMatch(t *testing.T, m *SessionManager, guildID string, challengerID string, challengeeID string, threadID string) {
+	const rounds = 200
+
+	challenger := &discordgo.User{ID: challengerID}
+	challengee := &discordgo.User{ID: challengeeID}
+	challenge := &AwaitingChallengeResponse{Challenger: challenger, Challengee: challengee}
+	if !m.Claim(guildID, challenge, challengerID, challengeeID) {
+		t.Errorf("%s: couldn't claim the challenge", threadID)
+		return
+	}
+
+	// the challengee presses accept twice at once
+	accepted := make(chan *MatchOngoing, 2)
+	var accepting sync.WaitGroup
+	for range 2 {
+		accepting.Add(1)
+		go func() {
+			defer accepting.Done()
+			if game, ok := acceptChallenge(m, guildID, challenge, threadID); ok {
+				accepted <- game
+			}
+		}()
+	}
+	accepting.Wait()
+	close(accepted)
+	if len(accepted) != 1 {
+		t.Errorf("%s: the challenge was accepted %d times", threadID, len(accepted))
+		return
+	}
+	game := <-accepted
+
+	// bystanders look the match up every way there is while the players pick
+	pokes := []func(){
+		func() {
+			if game, found := m.LockMatchInThread(guildID, threadID); found {
+				game.Unlock()
+			}
+		},
+		func() {
+			if session, found := m.Lock(guildID, challengerID); found {
+				session.Unlock()
+			}
+		},
+		func() {
+			if m.Claim(guildID, challenge, challengerID) {
+				t.Errorf("%s: claimed a player who's in a match", threadID)
+			}
+		},
+		func() {
+			m.Save(guildID, game)
+			m.Holds(guildID, game)
+		},
+	}
+
+	resolved := atomic.Int32{}
+	for range rounds {
+		start := make(chan struct{})
+		var round sync.WaitGroup
+		for _, userID := range []string{challengerID, challengeeID} {
+			round.Add(1)
+			go func() {
+				defer round.Done()
+				<-start
+				if chooseAction(m, guildID, userID, Guard) {
+					resolved.Add(1)
+				}
+			}()
+		}
+		for _, poke := range pokes {
+			round.Add(1)
+			go func() {
+				defer round.Done()
+				<-start
+				poke()
+			}()
+		}
+		close(start)
+		round.Wait()
+	}
+
+	// both players forfeit at once
+	removed := atomic.Int32{}
+	var forfeiting sync.WaitGroup
+	for _, userID := range []string{challengerID, challengeeID} {
+		forfeiting.Add(1)
+		go func() {
+			defer forfeiting.Done()
+			game, found := m.LockMatch(guildID, userID)
+			if !found {
+				return
+			}
+			defer game.Unlock()
+			if m.Remove(guildID, game, challengerID, challengeeID) {
+				removed.Add(1)
+			}
+		}()
+	}
+	forfeiting.Wait()
+
+	if _, found := m.LockMatchInThread(guildID, threadID); found {
+		t.Errorf("%s: the match is still found in its thread after it was removed", threadID)
+	}
+
+	game.Lock()
+	defer game.Unlock()
+	if resolved.Load() != rounds {
+		t.Errorf("%s: %d rounds resolved, want %d", threadID, resolved.Load(), rounds)
+	}
+	if len(game.Rounds) != rounds {
+		t.Errorf("%s: %d rounds recorded, want %d", threadID, len(game.Rounds), rounds)
+	}
+	if game.State.Round != rounds+1 {
+		t.Errorf("%s: on round %d, want %d", threadID, game.State.Round, rounds+1)
+	}
+	if removed.Load() != 1 {
+		t.Errorf("%s: the match was removed %d times", threadID, removed.Load())
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"hwacha/bagh/ai"
+	"hwacha/bagh/engine"
+)
+
+func runSolveCommandLine(args []string) {
+	flags := flag.NewFlagSet("solve", flag.ExitOnError)
+	rulesetName := flags.String("rules", engine.Classic.Name, "Ruleset preset to solve (classic, quick, long, high-hp)")
+	// the same terms a challenge can be made on, so any agreed ruleset can be solved
+	gamesToWin := flags.Int("games", 0, "Games to win, in place of the preset's (doesn't change the table)")
+	startingHP := flags.Int("hp", 0, "Starting HP, in place of the preset's")
+	maxBoost := flags.Int("boost", 0, "Boost cap, in place of the preset's")
+	out := flags.String("o", "", "Where to write the strategy table (defaults to "+filepath.Join(strategyDir(), "<rules>.table")+")")
+	tolerance := flags.Float64("tolerance", 1e-6, "Stop once no position's value changes by more than this in a sweep")
+	maxSweeps := flags.Int("sweeps", 2000, "Maximum number of value iteration sweeps")
+	flags.Parse(args)
+
+	rules, found := engine.PresetByName(*rulesetName)
+	if !found {
+		fmt.Println("Unknown ruleset: " + *rulesetName)
+		return
+	}
+	if *gamesToWin != 0 || *startingHP != 0 || *maxBoost != 0 {
+		rules = engine.CustomRuleset(cmp.Or(*gamesToWin, rules.GamesToWin), cmp.Or(*startingHP, rules.StartingHP), cmp.Or(*maxBoost, rules.MaxBoost))
+	}
+	if err := rules.Validate(); err != nil {
+		fmt.Println("Invalid ruleset: " + err.Error())
+		return
+	}
+
+	// custom rulesets all share a name, so their tables are told apart by their terms
+	name := rules.Name
+	if _, isPreset := engine.PresetByName(name); !isPreset {
+		name += "-" + strconv.Itoa(rules.StartingHP) + "hp-" + strconv.Itoa(rules.MaxBoost) + "boost"
+	}
+	path := *out
+	if path == "" {
+		path = filepath.Join(strategyDir(), name+".table")
+	}
+
+	table := ai.Solve(rules, *tolerance, *maxSweeps, func(positions int, sweep int, delta float64) {
+		if sweep == 1 || sweep%25 == 0 || delta <= *tolerance {
+			fmt.Printf("sweep %d over %d positions: largest change %.3g\n", sweep, positions, delta)
+		}
+	})
+
+	printSolveReport(table)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		fmt.Println(err)
+		return
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer file.Close()
+
+	if err := ai.WriteStrategyTable(file, table); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println("Wrote " + strconv.Itoa(table.Len()) + " positions to " + path)
+}
+
+func printSolveReport(table *ai.StrategyTable) {
+	rules := table.Rules
+	start := engine.NewState(rules)
+	strategy, value, _ := table.Lookup(start, 0)
+
+	fmt.Printf("Opening strategy: boost %.3f, attack %.3f, guard %.3f, heal %.3f (value %.3f)\n",
+		strategy[engine.Boost], strategy[engine.Attack], strategy[engine.Guard], strategy[engine.Heal], value)
+
+	// how often boosting from each level is ever part of an equilibrium
+	positionsAtBoost := make([]int, rules.MaxBoost)
+	boostedAtBoost := make([]int, rules.MaxBoost)
+	for _, key := range table.Keys() {
+		state := key.State(rules)
+		boost := state.Players[0].Boost
+		if boost >= rules.MaxBoost {
+			continue
+		}
+		positionsAtBoost[boost]++
+		strategy, _, found := table.Lookup(state, 0)
+		if found && strategy[engine.Boost] > 0 {
+			boostedAtBoost[boost]++
+		}
+	}
+	for boost := range positionsAtBoost {
+		fmt.Printf("Boosting to %d is played in %d of %d positions\n", boost+1, boostedAtBoost[boost], positionsAtBoost[boost])
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+
+	"hwacha/bagh/engine"
+)
+
+// a player's record, worked out from their archived matches
+type PlayerStats struct {
+	MatchesWon   int
+	MatchesLost  int
+	MatchesDrawn int
+	Forfeits     int
+
+	GamesWon   int
+	GamesLost  int
+	GamesDrawn int
+
+	// indexed by action
+	ActionCounts [4]int
+
+	Attacks       int
+	AttacksLanded int
+	// summed over every attack, for averaging
+	BoostBeforeAttacks int
+}
+
+func (stats PlayerStats) Matches() int {
+	return stats.MatchesWon + stats.MatchesLost + stats.MatchesDrawn
+}
+
+func (stats PlayerStats) Actions() int {
+	total := 0
+	for _, count := range stats.ActionCounts {
+		total += count
+	}
+	return total
+}
+
+// the fraction of attacks that did damage
+func (stats PlayerStats) AttackSuccessRate() float64 {
+	if stats.Attacks == 0 {
+		return 0
+	}
+	return float64(stats.AttacksLanded) / float64(stats.Attacks)
+}
+
+func (stats PlayerStats) AverageBoostBeforeAttacking() float64 {
+	if stats.Attacks == 0 {
+		return 0
+	}
+	return float64(stats.BoostBeforeAttacks) / float64(stats.Attacks)
+}
+
+// adds up the user's record over matches, which should all include them
+func computePlayerStats(matches []*ArchivedMatch, userID string) PlayerStats {
+	stats := PlayerStats{}
+	for _, match := range matches {
+		me := 0
+		if match.Players[1].ID == userID {
+			me = 1
+		}
+
+		switch match.Winner {
+		case engine.NoWinner:
+			stats.MatchesDrawn++
+		case me:
+			stats.MatchesWon++
+		default:
+			stats.MatchesLost++
+			if match.Outcome == OutcomeForfeit {
+				stats.Forfeits++
+			}
+		}
+
+		err := engine.Replay(match.Rules, match.Rounds, func(before engine.State, round engine.RoundRecord, events []engine.Event) {
+			// a player who forfeited the round didn't act in it
+			if round.Actions[me] != engine.Unchosen {
+				action := round.Actions[me]
+				stats.ActionCounts[action]++
+				if action == engine.Attack {
+					stats.Attacks++
+					stats.BoostBeforeAttacks += before.Players[me].Boost
+				}
+			}
+
+			for _, event := range events {
+				switch event := event.(type) {
+				case engine.AttackLanded:
+					if event.Attacker == me {
+						stats.AttacksLanded++
+					}
+				case engine.GameWon:
+					switch event.Winner {
+					case engine.NoWinner:
+						stats.GamesDrawn++
+					case me:
+						stats.GamesWon++
+					default:
+						stats.GamesLost++
+					}
+				}
+			}
+		})
+		if err != nil {
+			fmt.Println("error replaying match "+match.ID+": ", err)
+		}
+	}
+	return stats
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"hwacha/bagh/ai"
+	"hwacha/bagh/engine"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// SessionStore saves sessions to a directory, one JSON file per session,
+// so that they survive the bot restarting.
+// Interactions expire with the bot, so they aren't saved.
+type SessionStore struct {
+	dir string
+}
+
+func NewSessionStore(dir string) (*SessionStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &SessionStore{dir: dir}, nil
+}
+
+type userRecord struct {
+	ID       string
+	Username string
+}
+
+type playerRecord struct {
+	User         userRecord
+	Action       Action
+	ActionLocked bool
+	VotedToDraw  bool
+}
+
+type challengeRecord struct {
+	Challenger          userRecord
+	Challengee          userRecord
+	ChannelID           string
+	Rules               engine.Ruleset
+	ChallengeeChannelID string
+	ChallengeeMessageID string
+	Issued              time.Time
+}
+
+type matchRecord struct {
+	ThreadID            string
+	LastRoundMessageID  string
+	Challenger          playerRecord
+	Challengee          playerRecord
+	State               engine.State
+	Seed                uint64
+	AILevel             ai.Level
+	Started             time.Time
+	Rounds              []engine.RoundRecord
+	Timeouts            [2]int
+	Spectators          []string `json:",omitempty"`
+	ScoreboardChannelID string   `json:",omitempty"`
+	ScoreboardMessageID string   `json:",omitempty"`
+	RNG                 []byte
+	AIRNG               []byte
+}
+
+// SessionRecord is how a session is saved. Exactly one of Challenge and Match is set.
+type SessionRecord struct {
+	GuildID   string
+	Challenge *challengeRecord `json:",omitempty"`
+	Match     *matchRecord     `json:",omitempty"`
+}
+
+func recordUser(user *discordgo.User) userRecord {
+	return userRecord{ID: user.ID, Username: user.Username}
+}
+
+func (record userRecord) user() *discordgo.User {
+	return &discordgo.User{ID: record.ID, Username: record.Username}
+}
+
+func recordPlayer(player *Player) playerRecord {
+	return playerRecord{
+		User:         recordUser(player.User),
+		Action:       player.currentAction,
+		ActionLocked: player.actionLocked,
+		VotedToDraw:  player.votedToDraw,
+	}
+}
+
+func (record playerRecord) player() Player {
+	player := NewPlayer(record.User.user())
+	player.currentAction = record.Action
+	player.actionLocked = record.ActionLocked
+	player.votedToDraw = record.VotedToDraw
+	return player
+}
+
+// the caller must hold the session's lock
+func recordSession(guildID string, session SessionState) (SessionRecord, error) {
+	record := SessionRecord{GuildID: guildID}
+	switch session := session.(type) {
+	case *AwaitingChallengeResponse:
+		challenge := &challengeRecord{
+			Challenger: recordUser(session.Challenger),
+			Challengee: recordUser(session.Challengee),
+			ChannelID:  session.Channel.ID,
+			Rules:      session.Rules,
+			Issued:     session.Issued,
+		}
+		if session.ChallengeeMessage != nil {
+			challenge.ChallengeeChannelID = session.ChallengeeMessage.ChannelID
+			challenge.ChallengeeMessageID = session.ChallengeeMessage.ID
+		}
+		record.Challenge = challenge
+	case *MatchOngoing:
+		rng, err := session.rngSource.MarshalBinary()
+		if err != nil {
+			return record, err
+		}
+		aiRNG, err := session.aiRNGSource.MarshalBinary()
+		if err != nil {
+			return record, err
+		}
+		match := &matchRecord{
+			LastRoundMessageID: session.LastRoundMessageID,
+			Challenger:         recordPlayer(&session.Challenger),
+			Challengee:         recordPlayer(&session.Challengee),
+			State:              session.State,
+			Seed:               session.Seed,
+			AILevel:            session.AILevel,
+			Started:            session.Started,
+			Rounds:             session.Rounds,
+			Timeouts:           session.Timeouts,
+			Spectators:         session.Spectators,
+			RNG:                rng,
+			AIRNG:              aiRNG,
+		}
+		if session.Thread != nil {
+			match.ThreadID = session.Thread.ID
+		}
+		if session.Scoreboard != nil {
+			match.ScoreboardChannelID = session.Scoreboard.ChannelID
+			match.ScoreboardMessageID = session.Scoreboard.ID
+		}
+		record.Match = match
+	}
+	return record, nil
+}
+
+// challenge rebuilds a saved challenge. Its Channel only has its ID and
+// guild filled in, and it has no challenger interactions.
+func (record SessionRecord) challenge() *AwaitingChallengeResponse {
+	challenge := &AwaitingChallengeResponse{
+		Challenger: record.Challenge.Challenger.user(),
+		Challengee: record.Challenge.Challengee.user(),
+		Channel:    &discordgo.Channel{ID: record.Challenge.ChannelID, GuildID: record.GuildID},
+		Rules:      record.Challenge.Rules,
+		Issued:     record.Challenge.Issued,
+	}
+	if record.Challenge.ChallengeeMessageID != "" {
+		challenge.ChallengeeMessage = &discordgo.Message{
+			ID:        record.Challenge.ChallengeeMessageID,
+			ChannelID: record.Challenge.ChallengeeChannelID,
+		}
+	}
+	return challenge
+}
+
+// match rebuilds a saved match, with its randomness picking up where it left off.
+// Its Thread only has its ID and guild filled in.
+func (record SessionRecord) match() (*MatchOngoing, error) {
+	match := record.Match
+	rngSource, aiRNGSource := &rand.PCG{}, &rand.PCG{}
+	if err := rngSource.UnmarshalBinary(match.RNG); err != nil {
+		return nil, err
+	}
+	if err := aiRNGSource.UnmarshalBinary(match.AIRNG); err != nil {
+		return nil, err
+	}
+	if err := match.State.Rules.Validate(); err != nil {
+		return nil, err
+	}
+
+	game := &MatchOngoing{
+		Thread:             &discordgo.Channel{ID: match.ThreadID, GuildID: record.GuildID},
+		LastRoundMessageID: match.LastRoundMessageID,
+		Challenger:         match.Challenger.player(),
+		Challengee:         match.Challengee.player(),
+		State:              match.State,
+		Seed:               match.Seed,
+		AILevel:            match.AILevel,
+		Started:            match.Started,
+		Rounds:             match.Rounds,
+		Timeouts:           match.Timeouts,
+		Spectators:         match.Spectators,
+	}
+	if match.ScoreboardMessageID != "" {
+		game.Scoreboard = &discordgo.Message{
+			ID:        match.ScoreboardMessageID,
+			ChannelID: match.ScoreboardChannelID,
+		}
+	}
+	game.useSources(rngSource, aiRNGSource)
+	return game, nil
+}
+
+// a session is named after its guild and challenger,
+// who can only be the challenger of one session in a guild
+func (store *SessionStore) path(guildID string, challengerID string) string {
+	return filepath.Join(store.dir, guildID+"-"+challengerID+".json")
+}
+
+func sessionChallengerID(session SessionState) string {
+	switch session := session.(type) {
+	case *AwaitingChallengeResponse:
+		return session.Challenger.ID
+	case *MatchOngoing:
+		return session.Challenger.User.ID
+	}
+	return ""
+}
+
+// Save writes the session, replacing what was saved for it before.
+// The caller must hold the session's lock.
+func (store *SessionStore) Save(guildID string, session SessionState) error {
+	record, err := recordSession(guildID, session)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	// write to the side and rename, so a crash never leaves half a file
+	path := store.path(guildID, sessionChallengerID(session))
+	temp, err := os.CreateTemp(store.dir, ".session-*")
+	if err != nil {
+		return err
+	}
+	_, err = temp.Write(data)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
+
+// Delete forgets the session. The caller must hold the session's lock.
+func (store *SessionStore) Delete(guildID string, session SessionState) error {
+	err := os.Remove(store.path(guildID, sessionChallengerID(session)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// DeleteRecord forgets a session that was loaded but couldn't be restored.
+func (store *SessionStore) DeleteRecord(record SessionRecord) error {
+	challengerID := ""
+	if record.Challenge != nil {
+		challengerID = record.Challenge.Challenger.ID
+	} else if record.Match != nil {
+		challengerID = record.Match.Challenger.User.ID
+	}
+	err := os.Remove(store.path(record.GuildID, challengerID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// DeleteGuild forgets every session in the guild.
+func (store *SessionStore) DeleteGuild(guildID string) error {
+	paths, err := filepath.Glob(filepath.Join(store.dir, guildID+"-*.json"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Load reads every saved session. Files that can't be read are skipped
+// and reported in the returned error.
+func (store *SessionStore) Load() ([]SessionRecord, error) {
+	entries, err := os.ReadDir(store.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []SessionRecord{}
+	errs := []error{}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(store.dir, entry.Name()))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		record := SessionRecord{}
+		if err := json.Unmarshal(data, &record); err != nil {
+			errs = append(errs, errors.New(entry.Name()+": "+err.Error()))
+			continue
+		}
+		if (record.Challenge == nil) == (record.Match == nil) {
+			errs = append(errs, errors.New(entry.Name()+": not a challenge or a match"))
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, errors.Join(errs...)
+}